@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	defaultCameraFOV         = 45 * (pi32 / 180)
+	defaultCameraNear        = 0.1
+	defaultCameraFar         = 50
+	defaultCameraOrthoExtent = 3
+)
+
+// Camera is the point of view the scene is rendered from, together with its projection.
+// The aspect ratio is not part of the camera: it is taken from the viewport on each frame,
+// so the same camera can be used with any window size. The fields can be changed between frames.
+type Camera struct {
+	Name      string
+	Position  Vec3
+	Direction Vec3
+	Up        Vec3
+
+	Projection  Projection
+	FOV         float32 // vertical field of view in radians, perspective projection only
+	OrthoExtent float32 // half height of the view volume in world units, orthographic projection only
+
+	// Near and Far are the distances from the camera to the clipping planes along the view
+	// direction. The near plane must be in front of the camera, as the depth buffer stores
+	// the reciprocal depth in the perspective projection.
+	Near float32
+	Far  float32
+}
+
+// NewCamera returns the perspective camera with the default field of view and clipping planes.
+func NewCamera(position, direction Vec3) *Camera {
+	return &Camera{
+		Position:    position,
+		Direction:   direction,
+		Up:          Vec3{0, 1, 0},
+		Projection:  ProjectionPerspective,
+		FOV:         defaultCameraFOV,
+		OrthoExtent: defaultCameraOrthoExtent,
+		Near:        defaultCameraNear,
+		Far:         defaultCameraFar,
+	}
+}
+
+// Validate checks that the projection parameters describe a non-empty view volume.
+func (c *Camera) Validate() error {
+	switch {
+	case c.Direction == (Vec3{}):
+		return fmt.Errorf("camera has no direction")
+	case c.Up == (Vec3{}) || c.Direction.Normalize().CrossProduct(c.Up.Normalize()).Length() < 1e-3:
+		return fmt.Errorf("camera up vector must not be parallel to the direction")
+	case c.Near <= 0:
+		return fmt.Errorf("camera near plane must be in front of the camera")
+	case c.Far <= c.Near:
+		return fmt.Errorf("camera far plane must be further than the near plane")
+	case c.Projection == ProjectionPerspective && (c.FOV <= 0 || c.FOV >= pi32):
+		return fmt.Errorf("camera field of view must be between 0 and 180 degrees")
+	case c.Projection == ProjectionOrthographic && c.OrthoExtent <= 0:
+		return fmt.Errorf("camera orthographic extent must be positive")
+	}
+
+	return nil
+}
+
+// ProjectionMatrix returns the matrix transforming the view space to the clip space
+// for the given aspect ratio (width / height) of the frame. The logarithmic depth is
+// computed from W after clipping, its matrix is the reversed one.
+func (c *Camera) ProjectionMatrix(aspect float32, depthMode DepthMode) Matrix {
+	reversed := depthMode != DepthStandard
+
+	if c.Projection == ProjectionOrthographic {
+		return NewOrthographicCameraMatrix(c.OrthoExtent, aspect, c.Near, c.Far, reversed)
+	}
+
+	return NewPerspectiveCameraMatrix(c.FOV, aspect, c.Near, c.Far, reversed)
+}
+
+// Projection is the way the camera maps the scene onto the screen.
+type Projection int
+
+const (
+	ProjectionPerspective Projection = iota
+
+	// ProjectionOrthographic keeps parallel lines parallel and sizes independent of the
+	// distance, as in technical drawings.
+	ProjectionOrthographic
+)
+
+func (p Projection) String() string {
+	switch p {
+	case ProjectionPerspective:
+		return "perspective"
+	case ProjectionOrthographic:
+		return "orthographic"
+	default:
+		return fmt.Sprintf("Projection(%d)", int(p))
+	}
+}
+
+func ParseProjection(s string) (Projection, error) {
+	for p := ProjectionPerspective; p <= ProjectionOrthographic; p++ {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+
+	return ProjectionPerspective, fmt.Errorf("unknown projection: %s", s)
+}
+
+var (
+	// Isometric projection shows the three axes equally foreshortened.
+	isometricPitch = float32(math.Atan(1 / math.Sqrt2))
+
+	// Dimetric projection used by the pixel art games, where the lines
+	// along the ground axes are drawn two pixels across and one pixel up.
+	dimetricPitch = float32(math.Asin(0.5))
+)
+
+// NewIsometricCamera returns the orthographic camera looking at the target from the given
+// distance, rotated by 45° around the vertical axis and tilted down for the isometric projection.
+func NewIsometricCamera(target Vec3, distance float32) *Camera {
+	return newAxonometricCamera(target, distance, isometricPitch)
+}
+
+// NewDimetricCamera returns the orthographic camera looking at the target from the given
+// distance at the 2:1 dimetric angle.
+func NewDimetricCamera(target Vec3, distance float32) *Camera {
+	return newAxonometricCamera(target, distance, dimetricPitch)
+}
+
+func newAxonometricCamera(target Vec3, distance, pitch float32) *Camera {
+	const yaw = math.Pi / 4
+
+	offset := Vec3{
+		X: cos32(pitch) * sin32(yaw),
+		Y: sin32(pitch),
+		Z: cos32(pitch) * cos32(yaw),
+	}
+
+	camera := NewCamera(target.Add(offset.Multiply(distance)), offset.Multiply(-1))
+	camera.Projection = ProjectionOrthographic
+
+	return camera
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestAxonometricCamera checks how the world axes are foreshortened on the screen.
+func TestAxonometricCamera(t *testing.T) {
+	tests := map[string]struct {
+		camera *Camera
+		slope  float32 // of the ground axes on the screen
+	}{
+		"isometric": {camera: NewIsometricCamera(Vec3{1, 2, 3}, 5), slope: float32(math.Tan(math.Pi / 6))},
+		"dimetric":  {camera: NewDimetricCamera(Vec3{1, 2, 3}, 5), slope: 0.5},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := tt.camera
+
+			if err := c.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Projection != ProjectionOrthographic {
+				t.Errorf("projection is %v, want orthographic", c.Projection)
+			}
+
+			if d := c.Position.Add(c.Direction.Multiply(5)).Sub(Vec3{1, 2, 3}).Length(); d > 1e-4 {
+				t.Errorf("camera is looking %g away from the target", d)
+			}
+
+			var (
+				forward = c.Direction.Normalize()
+				right   = forward.CrossProduct(c.Up).Normalize()
+				up      = right.CrossProduct(forward)
+			)
+
+			// Screen space projections of the world axes
+			project := func(axis Vec3) Vec2 {
+				return Vec2{axis.DotProduct(right), axis.DotProduct(up)}
+			}
+
+			x, y, z := project(Vec3{1, 0, 0}), project(Vec3{0, 1, 0}), project(Vec3{0, 0, 1})
+
+			if abs(x.Length()-z.Length()) > 1e-5 {
+				t.Errorf("ground axes have different lengths: %g and %g", x.Length(), z.Length())
+			}
+
+			if abs(y.X) > 1e-5 {
+				t.Errorf("vertical axis is not vertical on the screen: %v", y)
+			}
+
+			for _, axis := range []Vec2{x, z} {
+				if got := abs(axis.Y / axis.X); abs(got-tt.slope) > 1e-5 {
+					t.Errorf("ground axis slope is %g, want %g", got, tt.slope)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSceneCamera(t *testing.T) {
+	target := [3]float32{0, 0, -10}
+
+	tests := map[string]struct {
+		data    SceneCameraData
+		want    Camera
+		wantErr bool
+	}{
+		"defaults": {
+			data: SceneCameraData{Direction: [3]float32{0, 0, -1}},
+			want: *NewCamera(Vec3{}, Vec3{0, 0, -1}),
+		},
+		"target": {
+			data: SceneCameraData{Position: [3]float32{0, 0, 2}, Target: &target},
+			want: *NewCamera(Vec3{0, 0, 2}, Vec3{0, 0, -12}),
+		},
+		"orthographic": {
+			data: SceneCameraData{Direction: [3]float32{0, 0, -1}, Projection: "orthographic", OrthoExtent: 10, Near: 1, Far: 100},
+			want: Camera{
+				Direction:   Vec3{0, 0, -1},
+				Up:          Vec3{0, 1, 0},
+				Projection:  ProjectionOrthographic,
+				FOV:         defaultCameraFOV,
+				OrthoExtent: 10,
+				Near:        1,
+				Far:         100,
+			},
+		},
+		"unknown projection": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, Projection: "isometric"},
+			wantErr: true,
+		},
+		"direction and target": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, Target: &target},
+			wantErr: true,
+		},
+		"no direction": {
+			data:    SceneCameraData{},
+			wantErr: true,
+		},
+		"up along the direction": {
+			data:    SceneCameraData{Direction: [3]float32{0, 2, 0}},
+			wantErr: true,
+		},
+		"near behind the camera": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, Near: -1},
+			wantErr: true,
+		},
+		"far before near": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, Near: 10, Far: 5},
+			wantErr: true,
+		},
+		"field of view too wide": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, FOV: 180},
+			wantErr: true,
+		},
+		"negative extent": {
+			data:    SceneCameraData{Direction: [3]float32{0, 0, -1}, Projection: "orthographic", OrthoExtent: -1},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := newSceneCamera(&tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
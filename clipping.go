@@ -5,9 +5,13 @@ import (
 )
 
 const (
-	// maxClipPoints is the maximum number of vertices a polygon can have.
-	// 9 is the worst case scenario for a triangle clipped against all 6 planes.
-	maxClipPoints = 9
+	// maxUserClipPlanes is the number of world space clip planes, see Frustum.SetUserPlanes.
+	maxUserClipPlanes = 6
+
+	// maxClipPoints is the maximum number of vertices a polygon can have. Each plane adds at
+	// most one vertex to the convex polygon: 9 for a triangle clipped against all 6 frustum
+	// planes, plus one for each user plane.
+	maxClipPoints = 9 + maxUserClipPlanes
 )
 
 const (
@@ -26,24 +30,16 @@ const (
 )
 
 type Polygon struct {
-	Intensity [maxClipPoints]float32
-	Points    [maxClipPoints]Vec4
-	UVs       [maxClipPoints]UV
-	Count     int
+	Vertices [maxClipPoints]Vertex
+	Count    int
 }
 
-func (p *Polygon) AddVertex(v Vec4, uv UV, intensity float32) {
-	p.Intensity[p.Count] = intensity
-	p.Points[p.Count] = v
-	p.UVs[p.Count] = uv
+func (p *Polygon) AddVertex(v *Vertex) {
+	p.Vertices[p.Count] = *v
 	p.Count++
 }
 
-func (p *Polygon) Triangulate(
-	points *[maxClipPoints][3]Vec4,
-	uvs *[maxClipPoints][3]UV,
-	intensity *[maxClipPoints][3]float32,
-) (numOut int) {
+func (p *Polygon) Triangulate(trianglesOut *[maxClipPoints][3]Vertex) (numOut int) {
 	if p.Count < 3 {
 		return 0
 	}
@@ -52,90 +48,114 @@ func (p *Polygon) Triangulate(
 	// the first vertex with the second and the third, then the first vertex with the
 	// third and the fourth, and so on (fan triangulation).
 	for i := 0; i < p.Count-2; i++ {
-		intensity[numOut] = [3]float32{p.Intensity[0], p.Intensity[i+1], p.Intensity[i+2]}
-		points[numOut] = [3]Vec4{p.Points[0], p.Points[i+1], p.Points[i+2]}
-		uvs[numOut] = [3]UV{p.UVs[0], p.UVs[i+1], p.UVs[i+2]}
+		trianglesOut[numOut] = [3]Vertex{p.Vertices[0], p.Vertices[i+1], p.Vertices[i+2]}
 		numOut++
 	}
 
 	return numOut
 }
 
+// Plane is given by the coefficients of its equation. The point p is inside the plane if
+// the dot product of the coefficients and p is non-negative. The frustum planes are in clip
+// space, where the coordinates are homogeneous, so the same test works for the points behind
+// the camera. User clip planes are in world space, see NewClipPlane.
 type Plane struct {
-	Point  Vec4
-	Normal Vec4
+	Coefficients Vec4
+}
+
+// NewClipPlane returns the world space plane through the point, keeping the side the normal
+// points to. The distance to the plane is in world units.
+func NewClipPlane(point, normal Vec3) Plane {
+	n := normal.Normalize()
+	return Plane{Coefficients: Vec4{n.X, n.Y, n.Z, -n.DotProduct(point)}}
 }
 
-func (p *Plane) DistanceToVertex(v Vec4) float32 {
-	return p.Normal.DotProduct(v) - p.Normal.DotProduct(p.Point)
+// Distance returns the signed distance to the point, scaled by the coefficients length.
+// It is positive inside the plane and changes linearly along the segments in clip space.
+func (p *Plane) Distance(q Vec4) float32 {
+	return p.Coefficients.DotProduct(q)
 }
 
 // IsVertexInside tells if a point is inside or outside the plane.
 func (p *Plane) IsVertexInside(q Vec4) bool {
-	return q.Sub(p.Point).DotProduct(p.Normal) <= 0
+	return p.Distance(q) >= 0
 }
 
-// Intersect returns a point between q0 and q1 intersect with the plane.
+// Intersect returns the point where the segment from q0 to q1 crosses the plane, and its
+// interpolation factor. The segment is expected to cross the plane.
 func (p *Plane) Intersect(q0, q1 Vec4) (Vec4, float32) {
-	u := q1.Sub(q0)
-	w := q0.Sub(p.Point)
-	d := p.Normal.DotProduct(u)
-	n := -p.Normal.DotProduct(w)
-	factor := n / d // interpolation factor
-	return q0.Add(u.Multiply(factor)), factor
+	d0, d1 := p.Distance(q0), p.Distance(q1)
+	factor := d0 / (d0 - d1)
+	return q0.Add(q1.Sub(q0).Multiply(factor)), factor
 }
 
+// Frustum is the view volume in clip space, -w ≤ x ≤ w, -w ≤ y ≤ w and 0 ≤ z ≤ w.
+// The near and far planes are part of the projection matrix. With the reversed depth
+// the near plane is at z = w and the far plane at z = 0, see DepthMode.
 type Frustum struct {
 	Planes      [6]Plane
+	clipPlanes  [6]Plane   // planes the triangles are clipped against, see SetGuardBand
+	userPlanes  []Plane    // world space, see SetUserPlanes
 	polygonPool *sync.Pool // *Polygon
 }
 
-func NewFrustum(zNear, zFar float32) *Frustum {
+func NewFrustum() *Frustum {
 	polygonPool := &sync.Pool{
 		New: func() any {
 			return &Polygon{}
 		},
 	}
 
-	return &Frustum{
+	f := &Frustum{
 		Planes: [6]Plane{
-			PlaneLeft: {
-				Point:  Vec4{-1, 0, 0, 1},
-				Normal: Vec4{1, 0, 0, 1},
-			},
-			PlaneRight: {
-				Point:  Vec4{1, 0, 0, 1},
-				Normal: Vec4{-1, 0, 0, 1},
-			},
-			PlaneTop: {
-				Point:  Vec4{0, -1, 0, 1},
-				Normal: Vec4{0, 1, 0, 1},
-			},
-			PlaneBottom: {
-				Point:  Vec4{0, 1, 0, 1},
-				Normal: Vec4{0, -1, 0, 1},
-			},
-			PlaneNear: {
-				Point:  Vec4{0, 0, zNear, 1},
-				Normal: Vec4{0, 0, -1, 0},
-			},
-			PlaneFar: {
-				Point:  Vec4{0, 0, zFar, 1},
-				Normal: Vec4{0, 0, 1, 0},
-			},
+			PlaneLeft:   {Coefficients: Vec4{1, 0, 0, 1}},  // w + x ≥ 0
+			PlaneRight:  {Coefficients: Vec4{-1, 0, 0, 1}}, // w - x ≥ 0
+			PlaneTop:    {Coefficients: Vec4{0, 1, 0, 1}},  // w + y ≥ 0
+			PlaneBottom: {Coefficients: Vec4{0, -1, 0, 1}}, // w - y ≥ 0
+			PlaneNear:   {Coefficients: Vec4{0, 0, 1, 0}},  // z ≥ 0
+			PlaneFar:    {Coefficients: Vec4{0, 0, -1, 1}}, // w - z ≥ 0
 		},
 		polygonPool: polygonPool,
 	}
+
+	f.SetGuardBand(1)
+
+	return f
+}
+
+// SetGuardBand moves the side planes the triangles are clipped against to -size*w ≤ x ≤ size*w
+// and -size*w ≤ y ≤ size*w. The parts of the triangles between the screen edges and the guard
+// band are skipped by the rasterizer, which is cheaper than splitting the triangles. Size 1 clips
+// the triangles to the screen edges. Near and far planes are not affected, as the depth and
+// the perspective divide are only valid between them.
+func (f *Frustum) SetGuardBand(size float32) {
+	f.clipPlanes = f.Planes
+
+	for _, pi := range []int{PlaneLeft, PlaneRight, PlaneTop, PlaneBottom} {
+		f.clipPlanes[pi].Coefficients.W = size
+	}
+}
+
+// SetUserPlanes sets the world space planes the triangles are clipped against in addition
+// to the frustum. Only the first maxUserClipPlanes planes are used.
+func (f *Frustum) SetUserPlanes(planes []Plane) {
+	f.userPlanes = append(f.userPlanes[:0], planes[:min(len(planes), maxUserClipPlanes)]...)
 }
 
 func (f *Frustum) BoxVisibility(bbox *[8]Vec4) int {
+	visibility := BoxVisibilityInside
+
 	for i := range f.Planes {
-		outside := 0
+		outside, clipped := 0, 0
 
 		for _, point := range bbox {
-			if f.Planes[i].DistanceToVertex(point) > 0 {
+			if !f.Planes[i].IsVertexInside(point) {
 				outside++
 			}
+
+			if !f.clipPlanes[i].IsVertexInside(point) {
+				clipped++
+			}
 		}
 
 		// All points are outside, the box is not visible
@@ -143,14 +163,66 @@ func (f *Frustum) BoxVisibility(bbox *[8]Vec4) int {
 			return BoxVisibilityOutside
 		}
 
-		// Some points are outside, clipping is needed
+		// Some points are outside of the guard band, clipping is needed
+		if clipped > 0 {
+			visibility = BoxVisibilityIntersect
+		}
+	}
+
+	return visibility
+}
+
+// UserBoxVisibility is BoxVisibility for the user planes and the world space box.
+func (f *Frustum) UserBoxVisibility(bbox *[8]Vec4) int {
+	visibility := BoxVisibilityInside
+
+	for i := range f.userPlanes {
+		outside := 0
+
+		for _, point := range bbox {
+			if !f.userPlanes[i].IsVertexInside(point) {
+				outside++
+			}
+		}
+
+		if outside == len(bbox) {
+			return BoxVisibilityOutside
+		}
+
 		if outside > 0 {
-			return BoxVisibilityIntersect
+			visibility = BoxVisibilityIntersect
+		}
+	}
+
+	return visibility
+}
+
+// outcode returns the bit masks of the view volume planes and of the clip planes the point
+// is outside of. The clip planes enclose the view volume, so the second mask is a subset of the first.
+func (f *Frustum) outcode(p Vec4) (outside, clip uint16) {
+	for i := range f.Planes {
+		if !f.Planes[i].IsVertexInside(p) {
+			outside |= 1 << i
+
+			if !f.clipPlanes[i].IsVertexInside(p) {
+				clip |= 1 << i
+			}
 		}
+	}
+
+	return outside, clip
+}
 
+// userOutcode returns the bit mask of the user planes the world space point is outside of,
+// following the frustum planes in the outcode bits.
+func (f *Frustum) userOutcode(p Vec3) (outside uint16) {
+	for i := range f.userPlanes {
+		if !f.userPlanes[i].IsVertexInside(p.ToVec4()) {
+			outside |= 1 << (len(f.Planes) + i)
+		}
 	}
 
-	return BoxVisibilityInside
+	return outside
 }
 
 func lerpUV(a, b UV, factor float32) UV {
@@ -164,15 +236,58 @@ func lerp32(a, b float32, factor float32) float32 {
 	return a + (b-a)*factor
 }
 
-func (f *Frustum) ClipTriangle(
-	pointsIn *[3]Vec4,
-	uvsIn *[3]UV,
-	intensityIn *[3]float32,
+func lerpVec3(a, b Vec3, factor float32) Vec3 {
+	return a.Add(b.Sub(a).Multiply(factor))
+}
+
+// lerpVertex interpolates all vertex attributes except the position.
+func lerpVertex(a, b *Vertex, position Vec4, factor float32) Vertex {
+	return Vertex{
+		Position:  position,
+		UV:        lerpUV(a.UV, b.UV, factor),
+		Light:     lerpRGB(a.Light, b.Light, factor),
+		World:     lerpVec3(a.World, b.World, factor),
+		Normal:    lerpVec3(a.Normal, b.Normal, factor),
+		Tangent:   lerpVec3(a.Tangent, b.Tangent, factor),
+		Bitangent: lerpVec3(a.Bitangent, b.Bitangent, factor),
+	}
+}
+
+// clipEdge returns the vertex where the edge from the inside vertex to the outside vertex
+// crosses the plane, given their distances to the plane.
+func clipEdge(in, out *Vertex, dIn, dOut float32) Vertex {
+	factor := dIn / (dIn - dOut)
+	position := in.Position.Add(out.Position.Sub(in.Position).Multiply(factor))
+	return lerpVertex(in, out, position, factor)
+}
+
+func (f *Frustum) ClipTriangle(verticesIn *[3]Vertex, trianglesOut *[maxClipPoints][3]Vertex) (numOut int) {
+	var (
+		outside0, clip0 = f.outcode(verticesIn[0].Position)
+		outside1, clip1 = f.outcode(verticesIn[1].Position)
+		outside2, clip2 = f.outcode(verticesIn[2].Position)
+		distances       [maxClipPoints]float32
+	)
+
+	// User planes have no guard band
+	if len(f.userPlanes) != 0 {
+		user0 := f.userOutcode(verticesIn[0].World)
+		user1 := f.userOutcode(verticesIn[1].World)
+		user2 := f.userOutcode(verticesIn[2].World)
+		outside0, outside1, outside2 = outside0|user0, outside1|user1, outside2|user2
+		clip0, clip1, clip2 = clip0|user0, clip1|user1, clip2|user2
+	}
+
+	switch {
+	case outside0&outside1&outside2 != 0:
+		// All vertices are outside of the same plane, even if within the guard band
+		return 0
+	case clip0|clip1|clip2 == 0:
+		// Inside the guard band, the rasterizer skips the pixels outside the screen
+		trianglesOut[0] = *verticesIn
+		return 1
+	}
 
-	pointsOut *[maxClipPoints][3]Vec4,
-	uvsOut *[maxClipPoints][3]UV,
-	intensityOut *[maxClipPoints][3]float32,
-) (numOut int) {
 	polygon := f.polygonPool.Get().(*Polygon)
 	defer f.polygonPool.Put(polygon)
 	polygon.Count = 0
@@ -181,45 +296,49 @@ func (f *Frustum) ClipTriangle(
 	defer f.polygonPool.Put(polygon2)
 	polygon2.Count = 0
 
-	polygon.AddVertex(pointsIn[0], uvsIn[0], intensityIn[0])
-	polygon.AddVertex(pointsIn[1], uvsIn[1], intensityIn[1])
-	polygon.AddVertex(pointsIn[2], uvsIn[2], intensityIn[2])
-
-	planes := []int{
-		PlaneLeft,
-		PlaneRight,
-		PlaneTop,
-		PlaneBottom,
-		PlaneNear,
-		PlaneFar,
-	}
+	polygon.AddVertex(&verticesIn[0])
+	polygon.AddVertex(&verticesIn[1])
+	polygon.AddVertex(&verticesIn[2])
 
-	// Iterate over each plane of the frustum and build a polygon from the input
+	// Iterate over the planes crossed by the triangle and build a polygon from the input
 	// triangle, containing only the vertices that are inside the frustum.
-	for _, pi := range planes {
-		plane := &f.Planes[pi]
+	crossed := clip0 | clip1 | clip2
+
+	for pi := range len(f.clipPlanes) + len(f.userPlanes) {
+		if crossed&(1<<pi) == 0 {
+			continue
+		}
+
+		// User planes are in world space. The world position is an affine function of the
+		// clip space position, so the edges are split at the same factor in both spaces.
+		for i := range polygon.Count {
+			if v := &polygon.Vertices[i]; pi < len(f.clipPlanes) {
+				distances[i] = f.clipPlanes[pi].Distance(v.Position)
+			} else {
+				distances[i] = f.userPlanes[pi-len(f.clipPlanes)].Distance(v.World.ToVec4())
+			}
+		}
+
 		polygon2.Count = 0
 
-		// Iterate over each edge of the polygon
+		// Iterate over each edge of the polygon. The intersection is always computed from
+		// the inside vertex, so that the edges shared by the neighbouring triangles are
+		// split at exactly the same point regardless of their direction.
 		for b := 0; b < polygon.Count; b++ {
 			a := (b + 1) % polygon.Count
-			uvA, uvB := polygon.UVs[a], polygon.UVs[b]
-			vertA, vertB := polygon.Points[a], polygon.Points[b]
-			intensityA, intensityB := polygon.Intensity[a], polygon.Intensity[b]
-
-			if plane.IsVertexInside(vertA) {
-				if !plane.IsVertexInside(vertB) {
-					intersect, factor := plane.Intersect(vertA, vertB)
-					intensity := lerp32(intensityA, intensityB, factor)
-					uv := lerpUV(uvA, uvB, factor)
-					polygon2.AddVertex(intersect, uv, intensity)
-				}
-				polygon2.AddVertex(vertA, uvA, intensityA)
-			} else if plane.IsVertexInside(vertB) {
-				intersect, factor := plane.Intersect(vertA, vertB)
-				intensity := lerp32(intensityA, intensityB, factor)
-				uv := lerpUV(uvA, uvB, factor)
-				polygon2.AddVertex(intersect, uv, intensity)
+			vertA, vertB := &polygon.Vertices[a], &polygon.Vertices[b]
+			insideA, insideB := distances[a] >= 0, distances[b] >= 0
+
+			switch {
+			case insideA && !insideB:
+				vertex := clipEdge(vertA, vertB, distances[a], distances[b])
+				polygon2.AddVertex(&vertex)
+				polygon2.AddVertex(vertA)
+			case insideA:
+				polygon2.AddVertex(vertA)
+			case insideB:
+				vertex := clipEdge(vertB, vertA, distances[b], distances[a])
+				polygon2.AddVertex(&vertex)
 			}
 		}
 
@@ -232,5 +351,5 @@ func (f *Frustum) ClipTriangle(
 	}
 
 	// Convert the polygon back to triangles
-	return polygon.Triangulate(pointsOut, uvsOut, intensityOut)
+	return polygon.Triangulate(trianglesOut)
 }
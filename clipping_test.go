@@ -0,0 +1,381 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// clipTestAttribute is a linear function of the clip space position. Clipping interpolates
+// the attributes linearly in clip space, so it must hold for the new vertices as well.
+var clipTestAttribute = Vec4{0.3, -0.2, 0.5, 0.7}
+
+// newClipTestTriangle returns the triangle with the attributes derived from the positions.
+func newClipTestTriangle(points [3]Vec4) [3]Vertex {
+	var vertices [3]Vertex
+
+	for i, p := range points {
+		vertices[i] = Vertex{
+			Position: p,
+			UV:       UV{U: clipTestAttribute.DotProduct(p), V: p.W},
+			World:    p.ToVec3(),
+		}
+	}
+
+	return vertices
+}
+
+// checkClippedTriangles verifies that the vertices are inside the clip planes, allowing for
+// the rounding errors proportional to the scale of the input, and that the attributes
+// were interpolated along with the positions.
+func checkClippedTriangles(t *testing.T, f *Frustum, triangles [][3]Vertex, scale float32) {
+	t.Helper()
+
+	eps := 1e-4 * max(scale, 1)
+
+	for i, triangle := range triangles {
+		for j, v := range triangle {
+			p := v.Position
+
+			for pi := range f.clipPlanes {
+				if d := f.clipPlanes[pi].Distance(p); d < -eps {
+					t.Errorf("triangle %d vertex %d %v is outside of plane %d by %g", i, j, p, pi, -d)
+				}
+			}
+
+			for pi := range f.userPlanes {
+				if d := f.userPlanes[pi].Distance(v.World.ToVec4()); d < -eps {
+					t.Errorf("triangle %d vertex %d %v is outside of user plane %d by %g", i, j, v.World, pi, -d)
+				}
+			}
+
+			if want := clipTestAttribute.DotProduct(p); abs(v.UV.U-want) > eps {
+				t.Errorf("triangle %d vertex %d attribute is %g, want %g", i, j, v.UV.U, want)
+			}
+
+			if abs(v.UV.V-p.W) > eps || abs(v.World.X-p.X) > eps || abs(v.World.Z-p.Z) > eps {
+				t.Errorf("triangle %d vertex %d attributes %v %v do not match position %v", i, j, v.UV, v.World, p)
+			}
+		}
+	}
+}
+
+func clipTriangle(f *Frustum, vertices [3]Vertex) [][3]Vertex {
+	var out [maxClipPoints][3]Vertex
+	n := f.ClipTriangle(&vertices, &out)
+	return out[:n]
+}
+
+func TestFrustum_ClipTriangle(t *testing.T) {
+	tests := map[string]struct {
+		points    [3]Vec4
+		triangles int
+	}{
+		"inside": {
+			points:    [3]Vec4{{-0.5, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0, 0.5, 0, 1}},
+			triangles: 1,
+		},
+		"inside scaled by w": {
+			points:    [3]Vec4{{-2, -2, 1, 4}, {2, -2, 1, 4}, {0, 3, 2, 4}},
+			triangles: 1,
+		},
+		"on the boundary": {
+			points:    [3]Vec4{{-1, -1, 0, 1}, {1, -1, 1, 1}, {1, 1, 0.5, 1}},
+			triangles: 1,
+		},
+		"outside left": {
+			points:    [3]Vec4{{-3, 0, 0, 1}, {-2, 1, 0, 1}, {-2, -1, 0, 1}},
+			triangles: 0,
+		},
+		"outside far": {
+			points:    [3]Vec4{{0, 0, 2, 1}, {0.5, 0, 3, 1}, {0, 0.5, 2, 1}},
+			triangles: 0,
+		},
+		"behind the camera": {
+			points:    [3]Vec4{{0, 0, -3, -1}, {0.5, 0, -3, -1}, {0, 0.5, -3, -1}},
+			triangles: 0,
+		},
+		"behind the camera mirrored inside": {
+			// x/w and y/w are inside the screen, but w is negative
+			points:    [3]Vec4{{0.5, 0.5, -0.5, -1}, {-0.5, 0.5, -0.5, -1}, {0, -0.5, -0.5, -1}},
+			triangles: 0,
+		},
+		"one vertex outside": {
+			points:    [3]Vec4{{-0.5, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0, 2, 0, 1}},
+			triangles: 2,
+		},
+		"two vertices outside": {
+			points:    [3]Vec4{{0, -0.5, 0, 1}, {2, -0.5, 0, 1}, {2, 0.5, 0, 1}},
+			triangles: 1,
+		},
+		"crossing the near plane": {
+			points:    [3]Vec4{{0, 0, -2, 0.5}, {0.5, 0, 1, 2}, {0, 0.5, 1, 2}},
+			triangles: 2,
+		},
+		"crossing the camera plane": {
+			// One vertex is behind the camera, its projection would wrap around the screen
+			points:    [3]Vec4{{0.2, 0.2, -1, -0.5}, {-1, 0, 1.5, 2}, {1, -1, 1.5, 2}},
+			triangles: 3,
+		},
+		"covering the frustum": {
+			points:    [3]Vec4{{-10, -10, 0, 1}, {10, -10, 0, 1}, {0, 10, 0, 1}},
+			triangles: 2,
+		},
+		"cutting all planes": {
+			points:    [3]Vec4{{-3, -3, -1, 1}, {3, -3, 2, 1}, {0, 3, 0.5, 1}},
+			triangles: 4,
+		},
+	}
+
+	f := NewFrustum()
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			triangles := clipTriangle(f, newClipTestTriangle(tt.points))
+
+			if len(triangles) != tt.triangles {
+				t.Fatalf("got %d triangles, want %d", len(triangles), tt.triangles)
+			}
+
+			checkClippedTriangles(t, f, triangles, 10)
+		})
+	}
+}
+
+func TestFrustum_ClipTriangle_Inside(t *testing.T) {
+	f := NewFrustum()
+	vertices := newClipTestTriangle([3]Vec4{{-0.5, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0, 0.5, 0, 1}})
+
+	triangles := clipTriangle(f, vertices)
+	if len(triangles) != 1 || triangles[0] != vertices {
+		t.Fatalf("triangle inside the frustum has changed: %v", triangles)
+	}
+}
+
+func TestFrustum_ClipTriangle_GuardBand(t *testing.T) {
+	tests := map[string]struct {
+		points    [3]Vec4
+		triangles int
+		unchanged bool
+	}{
+		"past the screen edge": {
+			points:    [3]Vec4{{0, 0, 0, 1}, {1.5, 0, 0, 1}, {1.5, 1.8, 0, 1}},
+			triangles: 1,
+			unchanged: true,
+		},
+		"past the guard band": {
+			points:    [3]Vec4{{0, 0, 0, 1}, {3, 0, 0, 1}, {0, 1, 0, 1}},
+			triangles: 2,
+		},
+		"crossing the near plane": {
+			points:    [3]Vec4{{0, 0, -2, 0.5}, {0.5, 0, 1, 2}, {0, 0.5, 1, 2}},
+			triangles: 2,
+		},
+		"outside the screen": {
+			points:    [3]Vec4{{1.2, 0, 0, 1}, {1.5, 0, 0, 1}, {1.5, 0.5, 0, 1}},
+			triangles: 0,
+		},
+		"outside the guard band": {
+			points:    [3]Vec4{{-3, 0, 0, 1}, {-2.5, 0, 0, 1}, {-2.5, 0.5, 0, 1}},
+			triangles: 0,
+		},
+	}
+
+	f := NewFrustum()
+	f.SetGuardBand(2)
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			vertices := newClipTestTriangle(tt.points)
+			triangles := clipTriangle(f, vertices)
+
+			if len(triangles) != tt.triangles {
+				t.Fatalf("got %d triangles, want %d", len(triangles), tt.triangles)
+			}
+
+			if tt.unchanged && triangles[0] != vertices {
+				t.Errorf("triangle inside the guard band has changed: %v", triangles[0])
+			}
+
+			checkClippedTriangles(t, f, triangles, 10)
+		})
+	}
+}
+
+func TestFrustum_ClipTriangle_UserPlanes(t *testing.T) {
+	tests := map[string]struct {
+		points    [3]Vec4
+		planes    []Plane
+		triangles int
+	}{
+		"inside": {
+			points:    [3]Vec4{{0.1, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0.3, 0.5, 0, 1}},
+			planes:    []Plane{NewClipPlane(Vec3{}, Vec3{1, 0, 0})},
+			triangles: 1,
+		},
+		"outside": {
+			points:    [3]Vec4{{-0.5, -0.5, 0, 1}, {-0.1, -0.5, 0, 1}, {-0.3, 0.5, 0, 1}},
+			planes:    []Plane{NewClipPlane(Vec3{}, Vec3{1, 0, 0})},
+			triangles: 0,
+		},
+		"one vertex outside": {
+			points:    [3]Vec4{{-0.5, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0.5, 0.5, 0, 1}},
+			planes:    []Plane{NewClipPlane(Vec3{}, Vec3{1, 0, 0})},
+			triangles: 2,
+		},
+		"crossing two planes": {
+			points: [3]Vec4{{-0.5, -0.5, 0, 1}, {0.5, -0.5, 0, 1}, {0, 0.5, 0, 1}},
+			planes: []Plane{
+				NewClipPlane(Vec3{-0.2, 0, 0}, Vec3{1, 0, 0}),
+				NewClipPlane(Vec3{0.2, 0, 0}, Vec3{-1, 0, 0}),
+			},
+			triangles: 3,
+		},
+		"square with two corners cut": {
+			points: [3]Vec4{{-3, -3, -1, 1}, {3, -3, 2, 1}, {0, 3, 0.5, 1}},
+			planes: []Plane{
+				NewClipPlane(Vec3{-0.8, 0, 0}, Vec3{1, 0.1, 0}),
+				NewClipPlane(Vec3{0.8, 0, 0}, Vec3{-1, 0.1, 0}),
+				NewClipPlane(Vec3{0, -0.8, 0}, Vec3{0.1, 1, 0}),
+				NewClipPlane(Vec3{0, 0.8, 0}, Vec3{0.1, -1, 0}),
+				NewClipPlane(Vec3{0.6, 0.6, 0}, Vec3{-1, -1, 0}),
+				NewClipPlane(Vec3{-0.6, -0.6, 0}, Vec3{1, 1, 0}),
+			},
+			triangles: 4,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := NewFrustum()
+			f.SetUserPlanes(tt.planes)
+			triangles := clipTriangle(f, newClipTestTriangle(tt.points))
+
+			if len(triangles) != tt.triangles {
+				t.Fatalf("got %d triangles, want %d", len(triangles), tt.triangles)
+			}
+
+			checkClippedTriangles(t, f, triangles, 10)
+		})
+	}
+}
+
+func TestFrustum_BoxVisibility(t *testing.T) {
+	box := func(x0, x1 float32) *[8]Vec4 {
+		return &[8]Vec4{
+			{x0, -0.5, 0, 1}, {x0, -0.5, 0.5, 1}, {x0, 0.5, 0, 1}, {x0, 0.5, 0.5, 1},
+			{x1, -0.5, 0, 1}, {x1, -0.5, 0.5, 1}, {x1, 0.5, 0, 1}, {x1, 0.5, 0.5, 1},
+		}
+	}
+
+	tests := map[string]struct {
+		bbox      *[8]Vec4
+		guardBand float32
+		want      int
+	}{
+		"inside":                 {box(-0.5, 0.5), 1, BoxVisibilityInside},
+		"crossing the screen":    {box(0.5, 1.5), 1, BoxVisibilityIntersect},
+		"inside the guard band":  {box(0.5, 1.5), 2, BoxVisibilityInside},
+		"crossing the band":      {box(0.5, 2.5), 2, BoxVisibilityIntersect},
+		"outside the screen":     {box(1.5, 1.8), 2, BoxVisibilityOutside},
+		"outside the guard band": {box(2.5, 3), 2, BoxVisibilityOutside},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := NewFrustum()
+			f.SetGuardBand(tt.guardBand)
+
+			if got := f.BoxVisibility(tt.bbox); got != tt.want {
+				t.Errorf("got visibility %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrustum_ClipTriangle_SharedEdge(t *testing.T) {
+	f := NewFrustum()
+
+	// Two triangles sharing the edge crossing the right plane, listed in opposite directions
+	a, b := Vec4{0, 0.3, 0.2, 1}, Vec4{3, -0.4, 0.6, 1.5}
+	want, _ := f.Planes[PlaneRight].Intersect(a, b)
+
+	for _, points := range [][3]Vec4{{a, b, {0, -0.5, 0, 1}}, {b, a, {0.5, 0.5, 0, 1}}} {
+		found := false
+
+		for _, triangle := range clipTriangle(f, newClipTestTriangle(points)) {
+			for _, v := range triangle {
+				found = found || v.Position == want
+			}
+		}
+
+		if !found {
+			t.Errorf("triangle %v is not split at %v", points, want)
+		}
+	}
+}
+
+func TestFacingCamera(t *testing.T) {
+	camera := NewCamera(Vec3{0, 0, 5}, Vec3{0, 0, -1})
+
+	// Counter-clockwise when looking from the camera
+	front := [3]Vec3{{-1, -1, 0}, {1, -1, 0}, {0, 1, 0}}
+	back := [3]Vec3{front[0], front[2], front[1]}
+
+	for _, projection := range []Projection{ProjectionPerspective, ProjectionOrthographic} {
+		camera.Projection = projection
+		matrix := camera.ProjectionMatrix(1, DepthReversed).Multiply(NewViewMatrix(camera.Position, camera.Direction, camera.Up))
+
+		toClip := func(triangle [3]Vec3) *[3]Vec4 {
+			var points [3]Vec4
+			for i, p := range triangle {
+				points[i] = p.ToVec4()
+				matrixMultiplyVec4Inplace(&matrix, &points[i])
+			}
+			return &points
+		}
+
+		if !facingCamera(toClip(front)) {
+			t.Errorf("%s: front face is culled", projection)
+		}
+
+		if facingCamera(toClip(back)) {
+			t.Errorf("%s: back face is not culled", projection)
+		}
+	}
+}
+
+func FuzzFrustum_ClipTriangle(f *testing.F) {
+	f.Add(float32(-0.5), float32(-0.5), float32(0), float32(1), float32(0.5), float32(-0.5), float32(0), float32(1), float32(0), float32(0.5), float32(0), float32(1))
+	f.Add(float32(0.2), float32(0.2), float32(-1.5), float32(-0.5), float32(-1), float32(0), float32(1), float32(2), float32(1), float32(-1), float32(1), float32(2))
+	f.Add(float32(-3), float32(-3), float32(-3), float32(1), float32(3), float32(-3), float32(3), float32(1), float32(0), float32(3), float32(0), float32(1))
+
+	frustum := NewFrustum()
+
+	f.Fuzz(func(t *testing.T, x0, y0, z0, w0, x1, y1, z1, w1, x2, y2, z2, w2 float32) {
+		points := [3]Vec4{{x0, y0, z0, w0}, {x1, y1, z1, w1}, {x2, y2, z2, w2}}
+
+		// Keep the coordinates in the range where the rounding errors stay predictable
+		var scale float32
+		for _, v := range []float32{x0, y0, z0, w0, x1, y1, z1, w1, x2, y2, z2, w2} {
+			if math.IsNaN(float64(v)) || abs(v) > 1e3 || (v != 0 && abs(v) < 1e-3) {
+				t.Skip()
+			}
+
+			scale = max(scale, abs(v))
+		}
+
+		triangles := clipTriangle(frustum, newClipTestTriangle(points))
+		checkClippedTriangles(t, frustum, triangles, scale)
+
+		inside := true
+		for _, p := range points {
+			for pi := range frustum.Planes {
+				inside = inside && frustum.Planes[pi].IsVertexInside(p)
+			}
+		}
+
+		if inside && len(triangles) != 1 {
+			t.Errorf("triangle inside the frustum was split into %d triangles", len(triangles))
+		}
+	})
+}
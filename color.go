@@ -0,0 +1,148 @@
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// RGB is a linear color value with float components, where 1.0 is the full intensity.
+// Unlike color.RGBA, components may go above 1.0 when multiple lights are added up.
+type RGB struct {
+	R, G, B float32
+}
+
+func RGBFromColor(c color.RGBA) RGB {
+	return RGB{
+		R: float32(c.R) / 255,
+		G: float32(c.G) / 255,
+		B: float32(c.B) / 255,
+	}
+}
+
+func (c RGB) Add(other RGB) RGB {
+	return RGB{c.R + other.R, c.G + other.G, c.B + other.B}
+}
+
+func (c RGB) Multiply(scalar float32) RGB {
+	return RGB{c.R * scalar, c.G * scalar, c.B * scalar}
+}
+
+func (c RGB) Modulate(other RGB) RGB {
+	return RGB{c.R * other.R, c.G * other.G, c.B * other.B}
+}
+
+// Quantize rounds the intensity of the color to the nearest of the given number of
+// levels per unit, keeping the hue. Used for cel shading, where the light comes in bands.
+func (c RGB) Quantize(levels int) RGB {
+	intensity := max(c.R, c.G, c.B)
+	if intensity <= 0 {
+		return c
+	}
+
+	banded := round32(intensity*float32(levels)) / float32(levels)
+
+	return c.Multiply(banded / intensity)
+}
+
+func lerpRGB(a, b RGB, factor float32) RGB {
+	return RGB{
+		R: a.R + (b.R-a.R)*factor,
+		G: a.G + (b.G-a.G)*factor,
+		B: a.B + (b.B-a.B)*factor,
+	}
+}
+
+// clampChannel converts a color channel value to uint8, saturating instead of wrapping around.
+func clampChannel(v float32) uint8 {
+	if v >= 255 {
+		return 255
+	}
+
+	if v <= 0 {
+		return 0
+	}
+
+	return uint8(v)
+}
+
+// colorLight returns the color c lit by the given light.
+func colorLight(c color.RGBA, light RGB) color.RGBA {
+	return color.RGBA{
+		R: clampChannel(float32(c.R) * light.R),
+		G: clampChannel(float32(c.G) * light.G),
+		B: clampChannel(float32(c.B) * light.B),
+		A: c.A,
+	}
+}
+
+// colorFromRGB converts the 0..1 color to 8 bits per channel.
+func colorFromRGB(c RGB) color.RGBA {
+	return color.RGBA{
+		R: clampChannel(c.R * 255),
+		G: clampChannel(c.G * 255),
+		B: clampChannel(c.B * 255),
+		A: 255,
+	}
+}
+
+const srgbEncodeSteps = 4096
+
+var (
+	srgbDecodeLUT [256]float32
+	srgbEncodeLUT [srgbEncodeSteps + 1]uint8
+)
+
+func init() {
+	for i := range srgbDecodeLUT {
+		v := float64(i) / 255
+
+		if v <= 0.04045 {
+			srgbDecodeLUT[i] = float32(v / 12.92)
+		} else {
+			srgbDecodeLUT[i] = float32(math.Pow((v+0.055)/1.055, 2.4))
+		}
+	}
+
+	for i := range srgbEncodeLUT {
+		v := float64(i) / srgbEncodeSteps
+
+		if v <= 0.0031308 {
+			v *= 12.92
+		} else {
+			v = 1.055*math.Pow(v, 1/2.4) - 0.055
+		}
+
+		srgbEncodeLUT[i] = uint8(math.Round(v * 255))
+	}
+}
+
+// linearFromSRGB decodes the sRGB color to the linear 0..1 range.
+func linearFromSRGB(c color.RGBA) RGB {
+	return RGB{
+		R: srgbDecodeLUT[c.R],
+		G: srgbDecodeLUT[c.G],
+		B: srgbDecodeLUT[c.B],
+	}
+}
+
+// srgbFromLinear encodes the linear color to sRGB, clamping it to the 0..1 range.
+func srgbFromLinear(c RGB) color.RGBA {
+	return color.RGBA{
+		R: srgbEncodeChannel(c.R),
+		G: srgbEncodeChannel(c.G),
+		B: srgbEncodeChannel(c.B),
+		A: 255,
+	}
+}
+
+func srgbEncodeChannel(v float32) uint8 {
+	if v >= 1 {
+		return 255
+	}
+
+	if v <= 0 {
+		return 0
+	}
+
+	return srgbEncodeLUT[int(v*srgbEncodeSteps+0.5)]
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestColorLight(t *testing.T) {
+	var (
+		white = color.RGBA{255, 255, 255, 255}
+		red   = color.RGBA{255, 0, 0, 255}
+		green = color.RGBA{0, 255, 0, 255}
+		blue  = color.RGBA{0, 0, 255, 255}
+		down  = Vec3{0, -1, 0}
+	)
+
+	tests := map[string]struct {
+		lights  []*Light
+		surface color.RGBA
+		want    color.RGBA
+	}{
+		"white over full intensity": {
+			lights:  []*Light{NewAmbientLight(white, 0.8), NewDirectionalLight(down, white, 0.7)},
+			surface: white,
+			want:    color.RGBA{255, 255, 255, 255},
+		},
+		"colored lights over full intensity": {
+			// Each channel adds up to several times the full intensity, 8 bits would wrap around
+			lights: []*Light{
+				NewAmbientLight(red, 1.5),
+				NewDirectionalLight(down, red, 2),
+				NewAmbientLight(green, 1.2),
+				NewDirectionalLight(down, green, 1.2),
+				NewAmbientLight(blue, 3),
+				NewAmbientLight(white, 0.5),
+			},
+			surface: white,
+			want:    color.RGBA{255, 255, 255, 255},
+		},
+		"tinted by each channel": {
+			lights:  []*Light{NewAmbientLight(red, 2), NewDirectionalLight(down, green, 0.5), NewAmbientLight(blue, 0.25)},
+			surface: white,
+			want:    color.RGBA{255, 127, 63, 255},
+		},
+		"tinted surface": {
+			lights:  []*Light{NewAmbientLight(white, 0.5), NewAmbientLight(red, 3), NewDirectionalLight(down, green, 0.5)},
+			surface: color.RGBA{100, 150, 200, 128},
+			want:    color.RGBA{255, 150, 100, 128},
+		},
+		"lit from behind": {
+			lights:  []*Light{NewDirectionalLight(Vec3{0, 1, 0}, white, 3)},
+			surface: white,
+			want:    color.RGBA{0, 0, 0, 255},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var total RGB
+
+			// Summed up like the lights of the scene, see Renderer.illuminate
+			for _, light := range tt.lights {
+				light.prepare()
+				total = total.Add(light.Illuminate(Vec3{}, Vec3{0, 1, 0}))
+			}
+
+			if got := colorLight(tt.surface, total); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSRGB_RoundTrip(t *testing.T) {
+	for i := range 256 {
+		v := uint8(i)
+		c := color.RGBA{v, 255 - v, v / 2, 255}
+
+		if got := srgbFromLinear(linearFromSRGB(c)); got != c {
+			t.Errorf("%v is encoded back as %v", c, got)
+		}
+	}
+}
+
+func TestSRGB_Encode(t *testing.T) {
+	tests := map[string]struct {
+		in   float32
+		want uint8
+	}{
+		"negative":    {in: -1, want: 0},
+		"black":       {in: 0, want: 0},
+		"linear part": {in: 0.0025, want: 8},
+		"middle gray": {in: 0.214, want: 128},
+		"white":       {in: 1, want: 255},
+		"overexposed": {in: 5, want: 255},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := srgbFromLinear(RGB{tt.in, tt.in, tt.in}); got.R != tt.want {
+				t.Errorf("got %d, want %d", got.R, tt.want)
+			}
+		})
+	}
+}
+
+func TestRGB_Quantize(t *testing.T) {
+	tests := map[string]struct {
+		in     RGB
+		levels int
+		want   RGB
+	}{
+		"black":            {in: RGB{}, levels: 3, want: RGB{}},
+		"just above black": {in: RGB{0.01, 0.01, 0.01}, levels: 3, want: RGB{}},
+		"first band":       {in: RGB{0.2, 0.2, 0.2}, levels: 3, want: RGB{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		"half":             {in: RGB{0.5, 0.5, 0.5}, levels: 3, want: RGB{2.0 / 3, 2.0 / 3, 2.0 / 3}},
+		"below half":       {in: RGB{0.49, 0.49, 0.49}, levels: 3, want: RGB{1.0 / 3, 1.0 / 3, 1.0 / 3}},
+		"full":             {in: RGB{1, 1, 1}, levels: 3, want: RGB{1, 1, 1}},
+		"just below full":  {in: RGB{0.99, 0.99, 0.99}, levels: 3, want: RGB{1, 1, 1}},
+		"overexposed":      {in: RGB{1.2, 1.2, 1.2}, levels: 3, want: RGB{4.0 / 3, 4.0 / 3, 4.0 / 3}},
+		"single band":      {in: RGB{0.3, 0.3, 0.3}, levels: 1, want: RGB{}},
+		"single band half": {in: RGB{0.5, 0.5, 0.5}, levels: 1, want: RGB{1, 1, 1}},
+		"hue is preserved": {in: RGB{0.3, 0.15, 0}, levels: 3, want: RGB{1.0 / 3, 1.0 / 6, 0}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tt.in.Quantize(tt.levels)
+
+			if abs(got.R-tt.want.R) > 1e-6 || abs(got.G-tt.want.G) > 1e-6 || abs(got.B-tt.want.B) > 1e-6 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
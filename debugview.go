@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// DebugView replaces the shaded image with a visualization of the surface attributes.
+// The attributes are rasterized into the G-buffer, as in deferred shading.
+type DebugView int
+
+const (
+	DebugViewNone     DebugView = iota
+	DebugViewDepth              // linearized depth, closer is brighter
+	DebugViewNormals            // world space normals as colors
+	DebugViewUV                 // fractional part of the texture coordinates as red and green
+	DebugViewChecker            // checker pattern in texture space
+	DebugViewMaterial           // distinct color for each material
+	DebugViewOverdraw           // heatmap of the fragments written per pixel
+)
+
+const (
+	debugCheckerScale = 8 // checker squares per texture
+	debugOverdrawMax  = 8 // overdraw at which the heatmap saturates
+)
+
+func (v DebugView) String() string {
+	switch v {
+	case DebugViewNone:
+		return "none"
+	case DebugViewDepth:
+		return "depth"
+	case DebugViewNormals:
+		return "normals"
+	case DebugViewUV:
+		return "uv"
+	case DebugViewChecker:
+		return "checker"
+	case DebugViewMaterial:
+		return "material"
+	case DebugViewOverdraw:
+		return "overdraw"
+	default:
+		return fmt.Sprintf("DebugView(%d)", int(v))
+	}
+}
+
+// heatmapColor maps the value in 0..1 range to a blue-green-yellow-red gradient.
+func heatmapColor(t float32) color.RGBA {
+	stops := [...]RGB{
+		{0, 0, 1},
+		{0, 1, 0},
+		{1, 1, 0},
+		{1, 0, 0},
+	}
+
+	t = min(max(t, 0), 1) * float32(len(stops)-1)
+	i := min(int(t), len(stops)-2)
+
+	return colorFromRGB(lerpRGB(stops[i], stops[i+1], t-float32(i)))
+}
+
+// drawDebugView writes the debug visualization of the tile to the frame buffer.
+func (r *Renderer) drawDebugView(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		g         = r.gbuffer
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+
+			if r.debugView == DebugViewOverdraw {
+				if count := g.Overdraw[index]; count > 0 {
+					r.fb.Pixels[index] = heatmapColor(float32(count-1) / (debugOverdrawMax - 1))
+				} else {
+					r.fb.Pixels[index] = color.RGBA{A: 255}
+				}
+
+				continue
+			}
+
+			zRec := g.Depth[index]
+			if zRec <= 0 {
+				continue
+			}
+
+			var c color.RGBA
+
+			switch r.debugView {
+			case DebugViewDepth:
+				v := depthShade(r.rays.Depth(zRec), r.debugDepth[0], r.debugDepth[1])
+				c = color.RGBA{v, v, v, 255}
+			case DebugViewNormals:
+				c = normalColor(g.Normals[index])
+			case DebugViewUV:
+				uv := g.UVs[index]
+				c = colorFromRGB(RGB{uv.U - floor32(uv.U), uv.V - floor32(uv.V), 0})
+			case DebugViewChecker:
+				uv := g.UVs[index]
+				c = color.RGBA{60, 60, 60, 255}
+				if (int(floor32(uv.U*debugCheckerScale))+int(floor32(uv.V*debugCheckerScale)))&1 == 0 {
+					c = color.RGBA{200, 200, 200, 255}
+				}
+			case DebugViewMaterial:
+				c = materialColor(g.MaterialIDs[index] & gbufferMaterialMask)
+			}
+
+			r.fb.Pixels[index] = c
+		}
+	}
+}
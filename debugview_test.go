@@ -0,0 +1,193 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRenderer_DebugView(t *testing.T) {
+	const width, height = 64, 48
+
+	var (
+		wallMaterial   = NewMaterial("wall", nil)
+		squareMaterial = NewMaterial("square", nil)
+		wall           = setMaterial(newQuadObject(Vec3{0, 0, -6}, Vec3{0, 0, 1}, 10), wallMaterial)
+		square         = setMaterial(newQuadObject(Vec3{0, 0, -2}, Vec3{1, 0, 1}, 1), squareMaterial)
+	)
+
+	const (
+		wallX, wallY     = 4, 4 // the wall covers the whole frame
+		squareX, squareY = width / 2, height / 2
+	)
+
+	tests := map[string]struct {
+		view  DebugView
+		check func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA)
+	}{
+		"depth": {
+			view: DebugViewDepth,
+			check: func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA) {
+				if near, far := pixel(squareX, squareY), pixel(wallX, wallY); near.R <= far.R {
+					t.Errorf("closer square is %v, not brighter than the wall %v", near, far)
+				}
+			},
+		},
+		"normals": {
+			view: DebugViewNormals,
+			check: func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA) {
+				// -1..1 is mapped to 0..255
+				if got, want := pixel(wallX, wallY), (color.RGBA{127, 127, 255, 255}); got != want {
+					t.Errorf("wall facing +Z is %v, want %v", got, want)
+				}
+
+				if got, want := pixel(squareX, squareY), (color.RGBA{217, 127, 217, 255}); got != want {
+					t.Errorf("square facing +X+Z is %v, want %v", got, want)
+				}
+			},
+		},
+		"uv": {
+			view: DebugViewUV,
+			check: func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA) {
+				// U goes to the right, V goes up
+				left, right := pixel(wallX, wallY), pixel(width-1-wallX, wallY)
+				bottom := pixel(wallX, height-1-wallY)
+
+				if left.R >= right.R || left.G != right.G {
+					t.Errorf("U is %v on the left and %v on the right, want only red to increase", left, right)
+				}
+
+				if bottom.G >= left.G || bottom.R != left.R {
+					t.Errorf("V is %v at the bottom and %v at the top, want only green to increase", bottom, left)
+				}
+
+				// The wall is 10 units wide, 6 units away, so the middle half of it is visible
+				if left.R < 50 || right.R > 205 {
+					t.Errorf("U ranges from %d to %d, want about 64 to 191", left.R, right.R)
+				}
+			},
+		},
+		"checker": {
+			view: DebugViewChecker,
+			check: func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA) {
+				var (
+					light = color.RGBA{200, 200, 200, 255}
+					dark  = color.RGBA{60, 60, 60, 255}
+				)
+
+				// Above the square, only the wall is visible
+				for y := range 8 {
+					for x := range width {
+						uv := r.gbuffer.UVs[y*width+x]
+						u, v := uv.U*debugCheckerScale, uv.V*debugCheckerScale
+
+						want := dark
+						if (int(floor32(u))+int(floor32(v)))%2 == 0 {
+							want = light
+						}
+
+						if got := pixel(x, y); got != want {
+							t.Errorf("pixel %d, %d at UV %v is %v, want %v", x, y, uv, got, want)
+						}
+					}
+				}
+			},
+		},
+		"material": {
+			view: DebugViewMaterial,
+			check: func(t *testing.T, r *Renderer, pixel func(x, y int) color.RGBA) {
+				wallColor := materialColor(r.materialIDs[wallMaterial])
+				squareColor := materialColor(r.materialIDs[squareMaterial])
+
+				if wallColor == squareColor {
+					t.Fatalf("both materials are %v", wallColor)
+				}
+
+				if got := pixel(wallX, wallY); got != wallColor {
+					t.Errorf("wall is %v, want %v", got, wallColor)
+				}
+
+				if got := pixel(squareX, squareY); got != squareColor {
+					t.Errorf("square is %v, want %v", got, squareColor)
+				}
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			scene := &Scene{Objects: []*Object{wall, square}}
+
+			renderer := newTestRenderer(width, height)
+			renderer.DebugView = tt.view
+			renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+			tt.check(t, renderer, func(x, y int) color.RGBA {
+				return renderer.fb.Pixels[y*width+x]
+			})
+		})
+	}
+}
+
+func TestRenderer_DebugView_Overdraw(t *testing.T) {
+	const width, height = 64, 48
+
+	// The far square is drawn first, the near one is drawn over it where they overlap
+	far := newQuadObject(Vec3{-0.3, 0, -3}, Vec3{0, 0, 1}, 1)
+	near := newQuadObject(Vec3{0.3, 0, -2.5}, Vec3{0, 0, 1}, 1)
+	scene := &Scene{Objects: []*Object{mergeObjects(far, near)}}
+
+	renderer := newTestRenderer(width, height)
+	renderer.DebugView = DebugViewOverdraw
+	renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+	tests := map[string]struct {
+		x, y  int
+		count uint16
+	}{
+		"background": {x: 2, y: 2, count: 0},
+		"far only":   {x: width/2 - 12, y: height / 2, count: 1},
+		"near only":  {x: width/2 + 12, y: height / 2, count: 1},
+		"overlap":    {x: width / 2, y: height / 2, count: 2},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			index := tt.y*width + tt.x
+
+			if got := renderer.gbuffer.Overdraw[index]; got != tt.count {
+				t.Errorf("overdraw is %d, want %d", got, tt.count)
+			}
+
+			want := color.RGBA{A: 255}
+			if tt.count > 0 {
+				want = heatmapColor(float32(tt.count-1) / (debugOverdrawMax - 1))
+			}
+
+			if got := renderer.fb.Pixels[index]; got != want {
+				t.Errorf("pixel is %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestHeatmapColor(t *testing.T) {
+	tests := map[string]struct {
+		in   float32
+		want color.RGBA
+	}{
+		"below range": {in: -1, want: color.RGBA{0, 0, 255, 255}},
+		"start":       {in: 0, want: color.RGBA{0, 0, 255, 255}},
+		"one third":   {in: 1.0 / 3, want: color.RGBA{0, 255, 0, 255}},
+		"two thirds":  {in: 2.0 / 3, want: color.RGBA{255, 255, 0, 255}},
+		"end":         {in: 1, want: color.RGBA{255, 0, 0, 255}},
+		"above range": {in: 2, want: color.RGBA{255, 0, 0, 255}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := heatmapColor(tt.in); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// DepthMode selects how the view depth is stored in the depth buffer. In all modes greater
+// values are closer, with 1 at the near plane and 0, the clear value, at the far plane.
+type DepthMode int
+
+const (
+	DepthReversed    DepthMode = iota // projected depth from 1 to 0, precise at any distance
+	DepthStandard                     // projected depth from 0 to 1, stored as 1 - z, for comparison
+	DepthLogarithmic                  // logarithm of the depth for each pixel, reversed in orthographic
+)
+
+func (m DepthMode) String() string {
+	switch m {
+	case DepthReversed:
+		return "reversed"
+	case DepthStandard:
+		return "standard"
+	case DepthLogarithmic:
+		return "logarithmic"
+	default:
+		return fmt.Sprintf("DepthMode(%d)", int(m))
+	}
+}
+
+func ParseDepthMode(s string) (DepthMode, error) {
+	for m := DepthReversed; m <= DepthLogarithmic; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+
+	return DepthReversed, fmt.Errorf("unknown depth mode: %s", s)
+}
+
+// depthBias returns the bias of the depth buffer values of the screen space triangle,
+// like the polygon offset in OpenGL. The constant bias is scaled by the float precision
+// at the closest vertex, and the slope bias by the largest depth change per pixel.
+func depthBias(points *[3]Vec4, constant, slope float32) float32 {
+	var (
+		p0, p1, p2 = points[0], points[1], points[2]
+		zMax       = max(p0.Z, p1.Z, p2.Z)
+		bias       = constant * (math.Nextafter32(zMax, math.MaxFloat32) - zMax)
+	)
+
+	if area := (p1.X-p0.X)*(p2.Y-p0.Y) - (p2.X-p0.X)*(p1.Y-p0.Y); slope != 0 && area != 0 {
+		dzdx := ((p1.Z-p0.Z)*(p2.Y-p0.Y) - (p2.Z-p0.Z)*(p1.Y-p0.Y)) / area
+		dzdy := ((p2.Z-p0.Z)*(p1.X-p0.X) - (p1.Z-p0.Z)*(p2.X-p0.X)) / area
+		bias += slope * max(abs(dzdx), abs(dzdy))
+	}
+
+	return bias
+}
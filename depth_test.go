@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDepthBias(t *testing.T) {
+	var (
+		flat   = [3]Vec4{{0, 0, 0.5, 1}, {10, 0, 0.5, 1}, {0, 10, 0.5, 1}}
+		slopeX = [3]Vec4{{0, 0, 0.5, 1}, {10, 0, 0.6, 1}, {0, 10, 0.5, 1}}
+		slopeY = [3]Vec4{{0, 0, 0.5, 1}, {10, 0, 0.5, 1}, {0, 10, 0.3, 1}}
+		line   = [3]Vec4{{0, 0, 0.5, 1}, {10, 0, 0.6, 1}, {20, 0, 0.7, 1}}
+	)
+
+	// Distance to the next float after the closest vertex
+	ulp := func(z float32) float32 {
+		return math.Nextafter32(z, math.MaxFloat32) - z
+	}
+
+	tests := map[string]struct {
+		points          [3]Vec4
+		constant, slope float32
+		want            float32
+	}{
+		"none":             {points: slopeX, want: 0},
+		"constant":         {points: flat, constant: 4, want: 4 * ulp(0.5)},
+		"constant closest": {points: slopeX, constant: 1, want: ulp(0.6)},
+		"slope of flat":    {points: flat, slope: 2, want: 0},
+		"slope along x":    {points: slopeX, slope: 2, want: 2 * 0.01},
+		"slope along y":    {points: slopeY, slope: 1, want: 0.02},
+		"both":             {points: slopeX, constant: 1, slope: 1, want: ulp(0.6) + 0.01},
+		"negative":         {points: slopeX, constant: -1, slope: -1, want: -ulp(0.6) - 0.01},
+		"degenerate":       {points: line, constant: 1, slope: 1, want: ulp(0.7)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := depthBias(&tt.points, tt.constant, tt.slope); abs(got-tt.want) > 1e-7 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderer_DepthBias draws two coplanar squares: the one with the bias towards the
+// camera is visible regardless of the drawing order.
+func TestRenderer_DepthBias(t *testing.T) {
+	tests := map[string]struct {
+		constant, slope float32
+		biasedVisible   bool
+	}{
+		"constant":         {constant: 4, biasedVisible: true},
+		"slope":            {slope: 1, biasedVisible: true},
+		"away from camera": {constant: -4, slope: -1, biasedVisible: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			for _, biasedFirst := range []bool{false, true} {
+				var (
+					biased = newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 4)
+					plain  = newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 4)
+				)
+
+				biased.DepthBias, biased.SlopeDepthBias = tt.constant, tt.slope
+
+				// Rotated, so that the depth changes across the squares
+				biased.Rotation = Vec3{0.3, 0.5, 0}
+				plain.Rotation = biased.Rotation
+
+				objects := []*Object{plain, biased}
+				if biasedFirst {
+					objects = []*Object{biased, plain}
+				}
+
+				renderer := newTestRenderer(64, 48)
+				renderer.Picking = true
+				renderer.Draw(&Scene{Objects: objects, Lights: DefaultLights()}, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+				visible, wrong := 0, 0
+
+				for i := range renderer.fb.ObjectIDs {
+					result, ok := renderer.Pick(i%64, i/64)
+					if !ok {
+						continue
+					}
+
+					visible++
+
+					if (result.Object == biased) != tt.biasedVisible {
+						wrong++
+					}
+				}
+
+				if visible == 0 {
+					t.Fatal("squares are not visible")
+				}
+
+				if wrong != 0 {
+					t.Errorf("drawn first %t: %d of %d pixels show the wrong square", biasedFirst, wrong, visible)
+				}
+			}
+		})
+	}
+}
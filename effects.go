@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+)
+
+// VignetteEffect darkens the corners of the viewport. The darkening starts at Radius,
+// given as a fraction of the distance from the center to the corner.
+type VignetteEffect struct {
+	singlePass
+	Strength float32
+	Radius   float32
+}
+
+func NewVignetteEffect(strength, radius float32) *VignetteEffect {
+	return &VignetteEffect{
+		Strength: strength,
+		Radius:   radius,
+	}
+}
+
+func (e *VignetteEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	var (
+		cx, cy = frame.Center()
+		corner = Vec2{float32(frame.Bounds.Dx()) / 2, float32(frame.Bounds.Dy()) / 2}.Length()
+	)
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*frame.Width + x
+			distance := Vec2{float32(x) + 0.5 - cx, float32(y) + 0.5 - cy}.Length() / corner
+
+			t := min(max((distance-e.Radius)/(1-e.Radius), 0), 1)
+			t = t * t * (3 - 2*t) // smoothstep
+
+			frame.Dst[index] = frame.Src[index].Multiply(1 - e.Strength*t)
+		}
+	}
+}
+
+// BloomEffect makes the bright parts of the frame glow. Colors brighter than Threshold are
+// blurred with the given Radius in pixels and added back on top of the frame. The effects
+// run after tone mapping, so the Threshold is in the 0..1 range of the displayed colors.
+type BloomEffect struct {
+	Threshold float32
+	Intensity float32
+	Radius    int
+
+	bright []RGB
+	blur   []RGB
+}
+
+func NewBloomEffect(threshold, intensity float32, radius int) *BloomEffect {
+	return &BloomEffect{
+		Threshold: threshold,
+		Intensity: intensity,
+		Radius:    radius,
+	}
+}
+
+const (
+	bloomPassBright = iota
+	bloomPassBlurX
+	bloomPassBlurY
+	bloomPassComposite
+)
+
+func (e *BloomEffect) Passes() int {
+	return 4
+}
+
+func (e *BloomEffect) Setup(frame *PostFrame) {
+	if size := frame.Width * frame.Height; len(e.bright) != size {
+		e.bright = make([]RGB, size)
+		e.blur = make([]RGB, size)
+	}
+}
+
+func (e *BloomEffect) Apply(frame *PostFrame, pass int, x0, y0, x1, y1 int) {
+	var (
+		width  = frame.Width
+		bounds = frame.Bounds
+	)
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*width + x
+
+			switch pass {
+			case bloomPassBright:
+				c := frame.Src[index]
+				brightness := max(c.R, c.G, c.B)
+
+				if brightness > e.Threshold {
+					e.bright[index] = c.Multiply((brightness - e.Threshold) / brightness)
+				} else {
+					e.bright[index] = RGB{}
+				}
+			case bloomPassBlurX:
+				var sum RGB
+				for bx := x - e.Radius; bx <= x+e.Radius; bx++ {
+					sum = sum.Add(e.bright[y*width+min(max(bx, bounds.Min.X), bounds.Max.X-1)])
+				}
+
+				e.blur[index] = sum.Multiply(1 / float32(2*e.Radius+1))
+			case bloomPassBlurY:
+				var sum RGB
+				for by := y - e.Radius; by <= y+e.Radius; by++ {
+					sum = sum.Add(e.blur[min(max(by, bounds.Min.Y), bounds.Max.Y-1)*width+x])
+				}
+
+				e.bright[index] = sum.Multiply(1 / float32(2*e.Radius+1))
+			case bloomPassComposite:
+				frame.Dst[index] = frame.Src[index].Add(e.bright[index].Multiply(e.Intensity))
+			}
+		}
+	}
+}
+
+// ColorLUTEffect remaps the colors through a 3D lookup table, commonly used for color grading.
+// The table is loaded from a horizontal strip of N squares of N×N pixels, where red grows along
+// the X axis of each square, green along the Y axis, and blue from one square to the next.
+type ColorLUTEffect struct {
+	singlePass
+	Strength float32 // blends between the original (0) and the remapped (1) colors
+
+	size  int
+	table []RGB // indexed by b*size*size + g*size + r
+}
+
+func NewColorLUTEffect(img image.Image) (*ColorLUTEffect, error) {
+	bounds := img.Bounds()
+	size := bounds.Dy()
+
+	if size < 2 || bounds.Dx() != size*size {
+		return nil, fmt.Errorf("invalid LUT strip size %dx%d, expected N²xN", bounds.Dx(), bounds.Dy())
+	}
+
+	e := &ColorLUTEffect{
+		Strength: 1,
+		size:     size,
+		table:    make([]RGB, size*size*size),
+	}
+
+	for b := 0; b < size; b++ {
+		for g := 0; g < size; g++ {
+			for r := 0; r < size; r++ {
+				c := color.RGBAModel.Convert(img.At(bounds.Min.X+b*size+r, bounds.Min.Y+g)).(color.RGBA)
+				e.table[(b*size+g)*size+r] = RGBFromColor(c)
+			}
+		}
+	}
+
+	return e, nil
+}
+
+func LoadColorLUTFile(filename string) (*ColorLUTEffect, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewColorLUTEffect(img)
+}
+
+// lookup returns the trilinearly interpolated table value for the display color in 0..1 range.
+func (e *ColorLUTEffect) lookup(c RGB) RGB {
+	scale := float32(e.size - 1)
+
+	split := func(v float32) (int, int, float32) {
+		v = min(max(v, 0), 1) * scale
+		i := min(int(v), e.size-2)
+		return i, i + 1, v - float32(i)
+	}
+
+	r0, r1, tr := split(c.R)
+	g0, g1, tg := split(c.G)
+	b0, b1, tb := split(c.B)
+
+	at := func(r, g, b int) RGB {
+		return e.table[(b*e.size+g)*e.size+r]
+	}
+
+	c00 := lerpRGB(at(r0, g0, b0), at(r1, g0, b0), tr)
+	c10 := lerpRGB(at(r0, g1, b0), at(r1, g1, b0), tr)
+	c01 := lerpRGB(at(r0, g0, b1), at(r1, g0, b1), tr)
+	c11 := lerpRGB(at(r0, g1, b1), at(r1, g1, b1), tr)
+
+	return lerpRGB(lerpRGB(c00, c10, tg), lerpRGB(c01, c11, tg), tb)
+}
+
+func (e *ColorLUTEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*frame.Width + x
+			src := frame.Src[index]
+
+			// Lookup tables are authored for display colors
+			display := RGBFromColor(frame.EncodeColor(src))
+			graded := frame.DecodeColor(colorFromRGB(e.lookup(display)))
+
+			frame.Dst[index] = lerpRGB(src, graded, e.Strength)
+		}
+	}
+}
+
+// SharpenEffect increases the contrast between neighbouring pixels (unsharp masking).
+type SharpenEffect struct {
+	singlePass
+	Strength float32
+}
+
+func NewSharpenEffect(strength float32) *SharpenEffect {
+	return &SharpenEffect{
+		Strength: strength,
+	}
+}
+
+func (e *SharpenEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*frame.Width + x
+			c := frame.Src[index]
+
+			neighbours := frame.At(x-1, y).Add(frame.At(x+1, y)).Add(frame.At(x, y-1)).Add(frame.At(x, y+1))
+			edges := c.Multiply(4).Add(neighbours.Multiply(-1))
+
+			sharp := c.Add(edges.Multiply(e.Strength))
+			frame.Dst[index] = RGB{max(sharp.R, 0), max(sharp.G, 0), max(sharp.B, 0)}
+		}
+	}
+}
+
+// ChromaticAberrationEffect imitates a lens that focuses colors differently: the red and blue
+// channels are shifted in opposite directions, up to Strength pixels at the viewport corners.
+type ChromaticAberrationEffect struct {
+	singlePass
+	Strength float32
+}
+
+func NewChromaticAberrationEffect(strength float32) *ChromaticAberrationEffect {
+	return &ChromaticAberrationEffect{
+		Strength: strength,
+	}
+}
+
+func (e *ChromaticAberrationEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	var (
+		cx, cy = frame.Center()
+		corner = Vec2{float32(frame.Bounds.Dx()) / 2, float32(frame.Bounds.Dy()) / 2}.Length()
+	)
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			// Offset grows linearly towards the corners
+			dx := (float32(x) - cx) / corner * e.Strength
+			dy := (float32(y) - cy) / corner * e.Strength
+
+			red := frame.At(x+int(dx), y+int(dy))
+			blue := frame.At(x-int(dx), y-int(dy))
+
+			c := frame.Src[y*frame.Width+x]
+			frame.Dst[y*frame.Width+x] = RGB{red.R, c.G, blue.B}
+		}
+	}
+}
+
+// OutlineEffect draws lines along the silhouettes and creases of the geometry. Silhouettes
+// are found from the depth discontinuities: the reciprocal depth changes linearly across flat
+// surfaces, so its second derivative only spikes at the edges. Creases are found where the
+// angle between the neighbouring normals exceeds CreaseAngle.
+type OutlineEffect struct {
+	singlePass
+	Color          color.RGBA
+	Width          int     // in pixels
+	DepthThreshold float32 // relative change of the depth slope
+	CreaseAngle    float32 // in radians, 0 to disable
+}
+
+func NewOutlineEffect(c color.RGBA, width int) *OutlineEffect {
+	return &OutlineEffect{
+		Color:          c,
+		Width:          width,
+		DepthThreshold: 0.02,
+		CreaseAngle:    60 * (pi32 / 180),
+	}
+}
+
+func (e *OutlineEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	var (
+		c      = frame.DecodeColor(e.Color)
+		minCos = cos32(e.CreaseAngle)
+		offset = max(e.Width, 1)
+		width  = frame.Width
+		bounds = frame.Bounds
+	)
+
+	// The depth slope is only constant on flat surfaces for the linear depth
+	depthAt := func(x, y int) float32 {
+		x = min(max(x, bounds.Min.X), bounds.Max.X-1)
+		y = min(max(y, bounds.Min.Y), bounds.Max.Y-1)
+		return frame.renderer.rays.LinearDepth(frame.Depth[y*width+x])
+	}
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*width + x
+			frame.Dst[index] = frame.Src[index]
+
+			z := depthAt(x, y)
+			if z <= 0 {
+				continue
+			}
+
+			var (
+				left, right = depthAt(x-offset, y), depthAt(x+offset, y)
+				up, down    = depthAt(x, y-offset), depthAt(x, y+offset)
+				edge        bool
+			)
+
+			switch {
+			case left <= 0 || right <= 0 || up <= 0 || down <= 0:
+				edge = true // next to the background
+			case abs(left+right-2*z) > e.DepthThreshold*z, abs(up+down-2*z) > e.DepthThreshold*z:
+				edge = true
+			case e.CreaseAngle > 0:
+				n := frame.Normal(x, y)
+				for _, p := range [4][2]int{{x - offset, y}, {x + offset, y}, {x, y - offset}, {x, y + offset}} {
+					if image.Pt(p[0], p[1]).In(bounds) && n.DotProduct(frame.Normal(p[0], p[1])) < minCos {
+						edge = true
+						break
+					}
+				}
+			}
+
+			if edge {
+				frame.Dst[index] = c
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"testing"
+)
+
+func TestNewScenePostEffect(t *testing.T) {
+	tests := map[string]struct {
+		data    ScenePostEffectData
+		want    string
+		wantErr bool
+	}{
+		"vignette":             {data: ScenePostEffectData{Type: "vignette"}, want: "*main.VignetteEffect"},
+		"bloom":                {data: ScenePostEffectData{Type: "bloom"}, want: "*main.BloomEffect"},
+		"sharpen":              {data: ScenePostEffectData{Type: "sharpen"}, want: "*main.SharpenEffect"},
+		"chromatic aberration": {data: ScenePostEffectData{Type: "chromaticAberration"}, want: "*main.ChromaticAberrationEffect"},
+		"outline":              {data: ScenePostEffectData{Type: "outline"}, want: "*main.OutlineEffect"},
+		"unknown type":         {data: ScenePostEffectData{Type: "blur"}, wantErr: true},
+		"missing type":         {data: ScenePostEffectData{}, wantErr: true},
+		"lut without file":     {data: ScenePostEffectData{Type: "lut"}, wantErr: true},
+		"lut missing file":     {data: ScenePostEffectData{Type: "lut", File: "lut.png"}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			effect, err := newScenePostEffect(t.TempDir(), &tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := fmt.Sprintf("%T", effect); got != tt.want {
+				t.Errorf("effect is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVignetteEffect(t *testing.T) {
+	const width, height = 40, 20
+
+	frame := &PostFrame{
+		Width:  width,
+		Height: height,
+		Bounds: image.Rect(0, 0, width, height),
+		Src:    make([]RGB, width*height),
+		Dst:    make([]RGB, width*height),
+	}
+
+	for i := range frame.Src {
+		frame.Src[i] = RGB{1, 1, 1}
+	}
+
+	NewVignetteEffect(0.5, 0.5).Apply(frame, 0, 0, 0, width, height)
+
+	tests := map[string]struct {
+		x, y int
+		want float32
+	}{
+		"center":       {x: width / 2, y: height / 2, want: 1},
+		"inner radius": {x: width/2 + 5, y: height / 2, want: 1},
+		"top left":     {x: 0, y: 0, want: 0.5},
+		"bottom right": {x: width - 1, y: height - 1, want: 0.5},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The corner pixel centers are half a pixel inside the corners
+			if got := frame.Dst[tt.y*width+tt.x].R; abs(got-tt.want) > 0.01 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderer_ToonOutline checks that the silhouette of a flat square is outlined,
+// while its inside is left as is.
+func TestRenderer_ToonOutline(t *testing.T) {
+	const width, height = 64, 48
+
+	scene := &Scene{
+		Objects: []*Object{newQuadObject(Vec3{}, Vec3{0, 1, 0}, 2)},
+		Lights:  DefaultLights(),
+	}
+
+	renderer := newTestRenderer(width, height)
+	renderer.Toon = true
+	renderer.Draw(scene, NewCamera(Vec3{0, 2, 2}, Vec3{0, -1, -1}))
+
+	var (
+		fb      = renderer.fb
+		outline = renderer.ToonOutline.Color
+	)
+
+	// The background has no depth
+	objectAt := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= width || y >= height {
+			return false
+		}
+		return fb.ZBuffer[y*width+x] > 0
+	}
+
+	edges, inside := 0, 0
+
+	for y := range height {
+		for x := range width {
+			if !objectAt(x, y) {
+				continue
+			}
+
+			var (
+				c    = fb.Pixels[y*width+x]
+				near = 0
+			)
+
+			for _, d := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}, {-2, 0}, {2, 0}, {0, -2}, {0, 2}} {
+				if objectAt(x+d[0], y+d[1]) {
+					near++
+				}
+			}
+
+			switch {
+			case !objectAt(x-1, y) || !objectAt(x+1, y) || !objectAt(x, y-1) || !objectAt(x, y+1):
+				edges++
+				if c != outline {
+					t.Errorf("pixel %d, %d at the silhouette is %v, want the outline", x, y, c)
+				}
+			case near == 8:
+				inside++
+				if c == outline {
+					t.Errorf("pixel %d, %d inside the square is outlined", x, y)
+				}
+			}
+		}
+	}
+
+	if edges == 0 || inside == 0 {
+		t.Fatalf("square is not visible: %d edge and %d inside pixels", edges, inside)
+	}
+}
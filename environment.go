@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+type EnvironmentType int
+
+const (
+	EnvironmentTypeCubemap EnvironmentType = iota
+	EnvironmentTypePanorama
+)
+
+const (
+	CubeFacePositiveX = iota
+	CubeFaceNegativeX
+	CubeFacePositiveY
+	CubeFaceNegativeY
+	CubeFacePositiveZ
+	CubeFaceNegativeZ
+)
+
+// Environment is an image surrounding the scene at an infinite distance. It is drawn
+// behind all geometry and reflected by materials with non-zero reflectivity.
+type Environment struct {
+	typ      EnvironmentType
+	faces    [6]*Texture // cubemap faces in +X, -X, +Y, -Y, +Z, -Z order
+	panorama *Texture    // equirectangular projection
+}
+
+func NewCubemapEnvironment(faces [6]*Texture) *Environment {
+	return &Environment{
+		typ:   EnvironmentTypeCubemap,
+		faces: faces,
+	}
+}
+
+func NewPanoramaEnvironment(panorama *Texture) *Environment {
+	return &Environment{
+		typ:      EnvironmentTypePanorama,
+		panorama: panorama,
+	}
+}
+
+// LoadCubemapFiles loads a cubemap from six images in +X, -X, +Y, -Y, +Z, -Z order.
+func LoadCubemapFiles(filenames [6]string) (*Environment, error) {
+	var faces [6]*Texture
+
+	for i, filename := range filenames {
+		texture, err := LoadTextureFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load cubemap face %s: %w", filename, err)
+		}
+
+		faces[i] = texture
+	}
+
+	return NewCubemapEnvironment(faces), nil
+}
+
+func LoadPanoramaFile(filename string) (*Environment, error) {
+	texture, err := LoadTextureFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPanoramaEnvironment(texture), nil
+}
+
+// Sample returns the environment color in the given world space direction.
+// The direction does not need to be normalized.
+func (e *Environment) Sample(dir Vec3) color.RGBA {
+	switch e.typ {
+	case EnvironmentTypeCubemap:
+		return e.sampleCubemap(dir)
+	case EnvironmentTypePanorama:
+		return e.samplePanorama(dir)
+	default:
+		return color.RGBA{255, 0, 255, 255}
+	}
+}
+
+// sampleCubemap follows the OpenGL cubemap layout, where the face texture coordinates
+// go from the top-left corner of the image.
+func (e *Environment) sampleCubemap(dir Vec3) color.RGBA {
+	var (
+		face   int
+		sc, tc float32
+		ma     float32
+		ax     = abs(dir.X)
+		ay     = abs(dir.Y)
+		az     = abs(dir.Z)
+	)
+
+	switch {
+	case ax >= ay && ax >= az:
+		ma = ax
+		if dir.X > 0 {
+			face, sc, tc = CubeFacePositiveX, -dir.Z, -dir.Y
+		} else {
+			face, sc, tc = CubeFaceNegativeX, dir.Z, -dir.Y
+		}
+	case ay >= az:
+		ma = ay
+		if dir.Y > 0 {
+			face, sc, tc = CubeFacePositiveY, dir.X, dir.Z
+		} else {
+			face, sc, tc = CubeFaceNegativeY, dir.X, -dir.Z
+		}
+	default:
+		ma = az
+		if dir.Z > 0 {
+			face, sc, tc = CubeFacePositiveZ, dir.X, -dir.Y
+		} else {
+			face, sc, tc = CubeFaceNegativeZ, -dir.X, -dir.Y
+		}
+	}
+
+	if ma == 0 {
+		return color.RGBA{}
+	}
+
+	u := (sc/ma + 1) / 2
+	v := (tc/ma + 1) / 2
+
+	// Clamp to avoid wrapping around at the face edges
+	u = min(max(u, 0), 0.9999)
+	v = min(max(v, 0), 0.9999)
+
+	// Texture V axis goes from the bottom of the image
+	return e.faces[face].Sample(u, 1-v)
+}
+
+func (e *Environment) samplePanorama(dir Vec3) color.RGBA {
+	length := dir.Length()
+	if length == 0 {
+		return color.RGBA{}
+	}
+
+	u := 0.5 + float32(math.Atan2(float64(dir.X), float64(-dir.Z)))/(2*pi32)
+	v := 0.5 + float32(math.Asin(float64(dir.Y/length)))/pi32
+
+	u = min(max(u, 0), 0.9999)
+	v = min(max(v, 0.0001), 1)
+
+	return e.panorama.Sample(u, v)
+}
+
+// reflect returns the direction of the incident vector reflected about the normal.
+func reflect(incident, normal Vec3) Vec3 {
+	return incident.Sub(normal.Multiply(2 * normal.DotProduct(incident)))
+}
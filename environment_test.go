@@ -0,0 +1,97 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEnvironment_Sample(t *testing.T) {
+	var faces [6]*Texture
+	for i := range faces {
+		faces[i] = NewColorTexture(color.RGBA{uint8(i), 0, 0, 255})
+	}
+
+	cubemap := NewCubemapEnvironment(faces)
+
+	tests := map[string]struct {
+		dir  Vec3
+		face int
+	}{
+		"+X":                     {dir: Vec3{1, 0, 0}, face: CubeFacePositiveX},
+		"-X":                     {dir: Vec3{-1, 0, 0}, face: CubeFaceNegativeX},
+		"+Y":                     {dir: Vec3{0, 1, 0}, face: CubeFacePositiveY},
+		"-Y":                     {dir: Vec3{0, -1, 0}, face: CubeFaceNegativeY},
+		"+Z":                     {dir: Vec3{0, 0, 1}, face: CubeFacePositiveZ},
+		"-Z":                     {dir: Vec3{0, 0, -1}, face: CubeFaceNegativeZ},
+		"not normalized":         {dir: Vec3{0, 0, -10}, face: CubeFaceNegativeZ},
+		"largest component X":    {dir: Vec3{-0.8, 0.5, 0.7}, face: CubeFaceNegativeX},
+		"largest component Y":    {dir: Vec3{0.3, -0.9, -0.4}, face: CubeFaceNegativeY},
+		"largest component Z":    {dir: Vec3{0.6, 0.6, 0.61}, face: CubeFacePositiveZ},
+		"edge between X and Z":   {dir: Vec3{1, 0, 1}, face: CubeFacePositiveX},
+		"corner between X, Y, Z": {dir: Vec3{-1, -1, -1}, face: CubeFaceNegativeX},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := cubemap.Sample(tt.dir); int(got.R) != tt.face {
+				t.Errorf("sampled face %d, want %d", got.R, tt.face)
+			}
+		})
+	}
+}
+
+func TestEnvironment_Sample_Panorama(t *testing.T) {
+	// Four columns around the horizon, the top row is the upper hemisphere
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := range 2 {
+		for x := range 4 {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+
+	texture, err := NewImageTexture(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	panorama := NewPanoramaEnvironment(texture)
+
+	tests := map[string]struct {
+		dir      Vec3
+		col, row uint8
+	}{
+		"forward":    {dir: Vec3{0, -0.1, -1}, col: 2, row: 1},
+		"right":      {dir: Vec3{1, -0.1, 0}, col: 3, row: 1},
+		"left":       {dir: Vec3{-1, -0.1, 0}, col: 1, row: 1},
+		"back":       {dir: Vec3{-0.1, -0.1, 1}, col: 0, row: 1},
+		"forward up": {dir: Vec3{0, 0.5, -1}, col: 2, row: 0},
+		"almost up":  {dir: Vec3{0, 1, -0.1}, col: 2, row: 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := panorama.Sample(tt.dir); got.R != tt.col || got.G != tt.row {
+				t.Errorf("sampled column %d, row %d, want %d, %d", got.R, got.G, tt.col, tt.row)
+			}
+		})
+	}
+}
+
+func TestLoadSceneEnvironment_Errors(t *testing.T) {
+	tests := map[string]*SceneEnvironmentData{
+		"empty":                 {},
+		"cubemap and panorama":  {Cubemap: []string{"a", "b", "c", "d", "e", "f"}, Panorama: "sky.png"},
+		"five cubemap faces":    {Cubemap: []string{"a", "b", "c", "d", "e"}},
+		"missing cubemap face":  {Cubemap: []string{"a", "b", "c", "d", "e", "f"}},
+		"missing panorama file": {Panorama: "sky.png"},
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadSceneEnvironment(t.TempDir(), data); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
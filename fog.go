@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+)
+
+type FogMode int
+
+const (
+	FogModeNone FogMode = iota
+	FogModeLinear
+	FogModeExponential
+	FogModeExponentialSquared
+)
+
+func (m FogMode) String() string {
+	switch m {
+	case FogModeNone:
+		return "none"
+	case FogModeLinear:
+		return "linear"
+	case FogModeExponential:
+		return "exp"
+	case FogModeExponentialSquared:
+		return "exp2"
+	default:
+		return fmt.Sprintf("FogMode(%d)", int(m))
+	}
+}
+
+func ParseFogMode(s string) (FogMode, error) {
+	for m := FogModeNone; m <= FogModeExponentialSquared; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+
+	return FogModeNone, fmt.Errorf("unknown fog mode: %s", s)
+}
+
+// Fog blends the geometry with the fog color depending on the distance from the camera.
+// Distances are measured in world space units. The background is left as is.
+type Fog struct {
+	Mode    FogMode
+	Color   color.RGBA
+	Start   float32 // linear mode: distance where the fog begins
+	End     float32 // linear mode: distance where the fog is fully opaque
+	Density float32 // exponential modes
+}
+
+func DefaultFog() Fog {
+	return Fog{
+		Mode:    FogModeNone,
+		Color:   color.RGBA{50, 50, 50, 255},
+		Start:   5,
+		End:     30,
+		Density: 0.08,
+	}
+}
+
+// Amount returns the fog opacity at the given distance, from 0 (no fog) to 1.
+func (f *Fog) Amount(distance float32) float32 {
+	switch f.Mode {
+	case FogModeLinear:
+		if f.End <= f.Start {
+			return 0
+		}
+
+		return min(max((distance-f.Start)/(f.End-f.Start), 0), 1)
+	case FogModeExponential:
+		return 1 - exp32(-f.Density*distance)
+	case FogModeExponentialSquared:
+		d := f.Density * distance
+		return 1 - exp32(-d*d)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFog_Amount(t *testing.T) {
+	linear := Fog{Mode: FogModeLinear, Start: 10, End: 30}
+	exponential := Fog{Mode: FogModeExponential, Density: 0.1}
+	squared := Fog{Mode: FogModeExponentialSquared, Density: 0.1}
+
+	tests := map[string]struct {
+		fog      Fog
+		distance float32
+		want     float32
+	}{
+		"none":                {fog: Fog{Mode: FogModeNone, Start: 10, End: 30}, distance: 20, want: 0},
+		"linear at camera":    {fog: linear, distance: 0, want: 0},
+		"linear before start": {fog: linear, distance: 5, want: 0},
+		"linear at start":     {fog: linear, distance: 10, want: 0},
+		"linear halfway":      {fog: linear, distance: 20, want: 0.5},
+		"linear at end":       {fog: linear, distance: 30, want: 1},
+		"linear after end":    {fog: linear, distance: 100, want: 1},
+		"linear empty range":  {fog: Fog{Mode: FogModeLinear, Start: 10, End: 10}, distance: 20, want: 0},
+		"exp at camera":       {fog: exponential, distance: 0, want: 0},
+		"exp":                 {fog: exponential, distance: 10, want: 1 - exp32(-1)},
+		"exp2 at camera":      {fog: squared, distance: 0, want: 0},
+		"exp2":                {fog: squared, distance: 20, want: 1 - exp32(-4)},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.fog.Amount(tt.distance); abs(got-tt.want) > 1e-6 {
+				t.Errorf("got %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSceneFog(t *testing.T) {
+	tests := map[string]struct {
+		data    SceneFogData
+		want    Fog
+		wantErr bool
+	}{
+		"defaults": {
+			data: SceneFogData{Mode: "exp"},
+			want: Fog{Mode: FogModeExponential, Color: DefaultFog().Color, Start: 5, End: 30, Density: 0.08},
+		},
+		"linear range": {
+			data: SceneFogData{Mode: "linear", Start: 1, End: 2},
+			want: Fog{Mode: FogModeLinear, Color: DefaultFog().Color, Start: 1, End: 2, Density: 0.08},
+		},
+		"unknown mode": {
+			data:    SceneFogData{Mode: "exp3"},
+			wantErr: true,
+		},
+		"missing mode": {
+			data:    SceneFogData{},
+			wantErr: true,
+		},
+		"end before start": {
+			data:    SceneFogData{Mode: "linear", Start: 20, End: 10},
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := newSceneFog(&tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+)
+
+const (
+	// gbufferReceiveShadows is set in the material ID of pixels belonging to objects
+	// that receive shadows, and gbufferUnlit of pixels that keep their albedo, such as
+	// the clip plane caps. The remaining bits hold the material ID itself.
+	gbufferReceiveShadows = 1 << 15
+	gbufferUnlit          = 1 << 14
+	gbufferMaterialMask   = gbufferUnlit - 1
+)
+
+// GBuffer holds the surface attributes for deferred shading. Depth is shared with the
+// frame buffer Z-buffer. Tiles write to disjoint regions of the buffers, so each tile
+// effectively owns its own part of the G-buffer.
+type GBuffer struct {
+	Width       int
+	Height      int
+	Depth       []float32 // depth buffer, greater values are closer, 0 for the background
+	Albedo      []color.RGBA
+	Normals     []Vec3   // world space, normalized
+	MaterialIDs []uint16 // index in the renderer material table, 0 is no material
+
+	// Optional attributes for the debug views, only written when allocated.
+	UVs      []UV
+	Overdraw []uint16 // number of fragments written to the pixel
+
+	view *viewRays // decodes the depth, set by the renderer
+}
+
+func NewGBuffer(fb *FrameBuffer) *GBuffer {
+	size := fb.Width * fb.Height
+
+	return &GBuffer{
+		Width:       fb.Width,
+		Height:      fb.Height,
+		Depth:       fb.ZBuffer,
+		Albedo:      make([]color.RGBA, size),
+		Normals:     make([]Vec3, size),
+		MaterialIDs: make([]uint16, size),
+	}
+}
+
+// enableDebug allocates the attributes used by the debug views.
+func (g *GBuffer) enableDebug() {
+	if g.UVs == nil {
+		g.UVs = make([]UV, g.Width*g.Height)
+		g.Overdraw = make([]uint16, g.Width*g.Height)
+	}
+}
+
+// viewDepth returns the view depth of the depth buffer value.
+func (g *GBuffer) viewDepth(zRec float32) float32 {
+	return g.view.Depth(zRec)
+}
+
+// depthRange returns the view depth of the closest and the farthest visible pixels
+// in the region.
+func (g *GBuffer) depthRange(region image.Rectangle) (minDepth, maxDepth float32) {
+	for y := region.Min.Y; y < region.Max.Y; y++ {
+		for _, zRec := range g.Depth[y*g.Width+region.Min.X : y*g.Width+region.Max.X] {
+			if zRec <= 0 {
+				continue
+			}
+
+			d := g.viewDepth(zRec)
+			if maxDepth == 0 || d < minDepth {
+				minDepth = d
+			}
+
+			maxDepth = max(maxDepth, d)
+		}
+	}
+
+	return minDepth, maxDepth
+}
+
+// Export writes the G-buffer contents to the directory as PNG images: albedo, normals
+// mapped from -1..1 to 0..255, depth normalized to the visible range, and material IDs
+// shown as distinct colors.
+func (g *GBuffer) Export(dir string) error {
+	var (
+		size     = image.Rect(0, 0, g.Width, g.Height)
+		albedo   = image.NewRGBA(size)
+		normals  = image.NewRGBA(size)
+		depth    = image.NewGray(size)
+		material = image.NewRGBA(size)
+	)
+
+	minDepth, maxDepth := g.depthRange(size)
+
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			i := y*g.Width + x
+
+			zRec := g.Depth[i]
+			if zRec <= 0 {
+				albedo.SetRGBA(x, y, color.RGBA{A: 255})
+				normals.SetRGBA(x, y, color.RGBA{A: 255})
+				material.SetRGBA(x, y, color.RGBA{A: 255})
+				continue
+			}
+
+			albedo.SetRGBA(x, y, g.Albedo[i])
+			normals.SetRGBA(x, y, normalColor(g.Normals[i]))
+			depth.SetGray(x, y, color.Gray{Y: depthShade(g.viewDepth(zRec), minDepth, maxDepth)})
+			material.SetRGBA(x, y, materialColor(g.MaterialIDs[i]&gbufferMaterialMask))
+		}
+	}
+
+	images := map[string]image.Image{
+		"albedo":   albedo,
+		"normal":   normals,
+		"depth":    depth,
+		"material": material,
+	}
+
+	for name, img := range images {
+		filename := path.Join(dir, fmt.Sprintf("gbuffer_%s.png", name))
+		if err := writePNG(filename, img); err != nil {
+			return fmt.Errorf("failed to write %s: %w", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// normalColor maps the normal components from -1..1 to 0..255.
+func normalColor(n Vec3) color.RGBA {
+	return color.RGBA{
+		R: uint8((n.X + 1) * 127.5),
+		G: uint8((n.Y + 1) * 127.5),
+		B: uint8((n.Z + 1) * 127.5),
+		A: 255,
+	}
+}
+
+// depthShade returns the brightness of the pixel normalized to the depth range,
+// closer pixels are brighter.
+func depthShade(depth, minDepth, maxDepth float32) uint8 {
+	d := float32(1)
+	if maxDepth > minDepth {
+		d = 1 - (depth-minDepth)/(maxDepth-minDepth)
+	}
+
+	return uint8(32 + d*223)
+}
+
+// materialColor returns a distinct color for each material ID.
+func materialColor(id uint16) color.RGBA {
+	h := uint32(id) * 2654435761 // Knuth's multiplicative hash
+	return color.RGBA{
+		R: uint8(h>>24) | 64,
+		G: uint8(h>>16) | 64,
+		B: uint8(h>>8) | 64,
+		A: 255,
+	}
+}
+
+func writePNG(filename string, img image.Image) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(f, img); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+)
+
+// newGBufferScene returns a white wall lit from the front left, with a tilted red square in front of it.
+func newGBufferScene() *Scene {
+	wall := setMaterial(
+		newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 6),
+		NewMaterial("wall", NewColorTexture(color.RGBA{255, 255, 255, 255})),
+	)
+
+	square := setMaterial(
+		newQuadObject(Vec3{0.5, 0, -3}, Vec3{-0.5, 0.3, 1}, 1),
+		NewMaterial("square", NewColorTexture(color.RGBA{200, 50, 50, 255})),
+	)
+
+	return &Scene{
+		Objects: []*Object{wall, square},
+		Lights: []*Light{
+			NewAmbientLight(color.RGBA{255, 255, 255, 255}, 0.2),
+			NewDirectionalLight(Vec3{0.5, -0.3, -1}, color.RGBA{255, 240, 200, 255}, 0.8),
+		},
+	}
+}
+
+func TestRenderer_Deferred(t *testing.T) {
+	const width, height = 64, 48
+
+	draw := func(deferred bool) []color.RGBA {
+		renderer := newTestRenderer(width, height)
+		renderer.Deferred = deferred
+		renderer.Draw(newGBufferScene(), NewCamera(Vec3{}, Vec3{0, 0, -1}))
+		return renderer.fb.Pixels
+	}
+
+	forward, deferred := draw(false), draw(true)
+	lit := 0
+
+	for i := range forward {
+		f, d := forward[i], deferred[i]
+
+		// Interpolated and reconstructed positions may round differently
+		if abs(int(f.R)-int(d.R)) > 1 || abs(int(f.G)-int(d.G)) > 1 || abs(int(f.B)-int(d.B)) > 1 {
+			t.Errorf("pixel %d, %d is %v in forward and %v in deferred shading", i%width, i/width, f, d)
+		}
+
+		if f.R > 0 {
+			lit++
+		}
+	}
+
+	if lit == 0 {
+		t.Error("no pixels were lit")
+	}
+}
+
+func TestGBuffer(t *testing.T) {
+	const width, height = 32, 24
+
+	var (
+		texture = color.RGBA{200, 50, 50, 255}
+		quad    = newQuadObject(Vec3{0, 0, -4}, Vec3{0, 0, 1}, 2)
+		scene   = &Scene{Objects: []*Object{setMaterial(quad, NewMaterial("quad", NewColorTexture(texture)))}}
+	)
+
+	renderer := newTestRenderer(width, height)
+	renderer.Deferred = true
+	renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+	var (
+		g      = renderer.gbuffer
+		center = height/2*width + width/2
+		corner = 0
+	)
+
+	if got := g.Albedo[center]; got != texture {
+		t.Errorf("albedo is %v, want %v", got, texture)
+	}
+
+	if got := g.Normals[center]; got.Sub(Vec3{0, 0, 1}).Length() > 1e-5 {
+		t.Errorf("normal is %v, want 0, 0, 1", got)
+	}
+
+	if got := renderer.rays.Depth(g.Depth[center]); abs(got-4) > 1e-3 {
+		t.Errorf("depth is %g, want 4", got)
+	}
+
+	if got := renderer.materials[g.MaterialIDs[center]&gbufferMaterialMask]; got != quad.Faces[0].Material {
+		t.Errorf("material is %v, want %v", got, quad.Faces[0].Material)
+	}
+
+	// Nothing is drawn in the corner
+	if g.Depth[corner] > 0 || g.MaterialIDs[corner] != 0 {
+		t.Errorf("background depth is %g and material ID is %d, want no depth and no material", g.Depth[corner], g.MaterialIDs[corner])
+	}
+
+	dir := t.TempDir()
+	if err := renderer.ExportGBuffer(dir); err != nil {
+		t.Fatalf("failed to export: %s", err)
+	}
+
+	for name, want := range map[string]color.RGBA{
+		"albedo": texture,
+		"normal": {127, 127, 255, 255},
+	} {
+		f, err := os.Open(path.Join(dir, "gbuffer_"+name+".png"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := png.Decode(f)
+		_ = f.Close()
+
+		if err != nil {
+			t.Fatalf("failed to decode the %s image: %s", name, err)
+		}
+
+		if got := color.RGBAModel.Convert(img.At(width/2, height/2)); got != want {
+			t.Errorf("exported %s is %v, want %v", name, got, want)
+		}
+	}
+}
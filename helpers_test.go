@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+)
+
+// newTestRenderer returns a renderer drawing into a new frame buffer, with shadows disabled.
+func newTestRenderer(width, height int) *Renderer {
+	renderer := NewRenderer(NewFrameBuffer(width, height))
+	renderer.Shadows = false
+	return renderer
+}
+
+// newQuadObject returns a square of the given size facing the normal. The texture U axis is
+// the X axis projected onto the square (the Z axis for squares facing ±X), the V axis is
+// normal × U. The first face is the lower right half in UV space, the second is the upper left.
+func newQuadObject(center, normal Vec3, size float32) *Object {
+	normal = normal.Normalize()
+
+	u := Vec3{1, 0, 0}
+	if abs(normal.X) > 0.99 {
+		u = Vec3{0, 0, -normal.X}
+	}
+
+	u = u.Sub(normal.Multiply(u.DotProduct(normal))).Normalize().Multiply(size / 2)
+	v := normal.CrossProduct(u)
+
+	vertices := []Vec4{
+		center.Sub(u).Sub(v).ToVec4(),
+		center.Add(u).Sub(v).ToVec4(),
+		center.Add(u).Add(v).ToVec4(),
+		center.Sub(u).Add(v).ToVec4(),
+	}
+
+	faces := []Face{
+		{VertexIndices: [3]int{0, 1, 2}, UVs: [3]UV{{0, 0}, {1, 0}, {1, 1}}},
+		{VertexIndices: [3]int{0, 2, 3}, UVs: [3]UV{{0, 0}, {1, 1}, {0, 1}}},
+	}
+
+	return NewObject(NewMesh(vertices, nil, faces))
+}
+
+// setMaterial applies the material to all faces of the object.
+func setMaterial(object *Object, material *Material) *Object {
+	for i := range object.Faces {
+		object.Faces[i].Material = material
+	}
+	return object
+}
+
+// mergeObjects returns a single object with the faces of all given objects. Faces of an
+// object are drawn in order, so the result does not depend on how objects are scheduled.
+func mergeObjects(objects ...*Object) *Object {
+	var (
+		vertices []Vec4
+		faces    []Face
+	)
+
+	for _, object := range objects {
+		for _, face := range object.Faces {
+			for i := range face.VertexIndices {
+				face.VertexIndices[i] += len(vertices)
+			}
+			faces = append(faces, face)
+		}
+
+		vertices = append(vertices, object.Vertices...)
+	}
+
+	return NewObject(NewMesh(vertices, nil, faces))
+}
+
+// writeSceneFiles writes the files into a temporary directory and returns its path.
+func writeSceneFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, content := range files {
+		if err := os.WriteFile(path.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+const testSceneTriangle = `
+mtllib triangle.mtl
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vt 0 0
+vt 1 0
+vt 0 1
+usemtl red
+f 1/1 2/2 3/3
+`
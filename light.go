@@ -0,0 +1,219 @@
+package main
+
+import (
+	"image/color"
+)
+
+type LightType int
+
+// lightEpsilon is the distance below which a point is considered to be at the light position.
+const lightEpsilon = 1e-6
+
+const (
+	LightTypeAmbient LightType = iota
+	LightTypeDirectional
+	LightTypePoint
+	LightTypeSpot
+)
+
+type Light struct {
+	Type      LightType
+	Color     color.RGBA
+	Intensity float32
+
+	// Position is used by point and spot lights.
+	Position Vec3
+
+	// Direction is the direction the light travels in, used by directional and spot lights.
+	Direction Vec3
+
+	// Attenuation factors of point and spot lights: 1 / (constant + linear*d + quadratic*d²).
+	Constant, Linear, Quadratic float32
+
+	// Spot light cone angles in radians. The light fades out between the inner and the outer angle.
+	InnerAngle, OuterAngle float32
+
+	// Only directional and spot lights can cast shadows. ShadowBias is the distance in world
+	// units the shaded point is moved towards the light before the depth comparison, ShadowPCF
+	// is the radius of the percentage-closer filtering kernel in texels (0 disables filtering).
+	CastShadows bool
+	ShadowBias  float32
+	ShadowPCF   int
+
+	// Assigned by the renderer for the frame copy of the light.
+	shadowMap *ShadowMap
+
+	// Precalculated values, see prepare().
+	radiance           RGB
+	towards            Vec3
+	cosInner, cosOuter float32
+}
+
+func NewAmbientLight(c color.RGBA, intensity float32) *Light {
+	return &Light{
+		Type:      LightTypeAmbient,
+		Color:     c,
+		Intensity: intensity,
+	}
+}
+
+func NewDirectionalLight(direction Vec3, c color.RGBA, intensity float32) *Light {
+	return &Light{
+		Type:       LightTypeDirectional,
+		Direction:  direction,
+		Color:      c,
+		Intensity:  intensity,
+		ShadowBias: 0.05,
+	}
+}
+
+func NewPointLight(position Vec3, c color.RGBA, intensity float32) *Light {
+	return &Light{
+		Type:      LightTypePoint,
+		Position:  position,
+		Color:     c,
+		Intensity: intensity,
+		Constant:  1,
+		Linear:    0.09,
+		Quadratic: 0.032,
+	}
+}
+
+func NewSpotLight(position, direction Vec3, innerAngle, outerAngle float32, c color.RGBA, intensity float32) *Light {
+	return &Light{
+		Type:       LightTypeSpot,
+		Position:   position,
+		Direction:  direction,
+		InnerAngle: innerAngle,
+		OuterAngle: outerAngle,
+		Color:      c,
+		Intensity:  intensity,
+		Constant:   1,
+		Linear:     0.09,
+		Quadratic:  0.032,
+		ShadowBias: 0.05,
+	}
+}
+
+// DefaultLights returns the lighting used when a scene does not define any lights:
+// half ambient, half directional light coming from the top left.
+func DefaultLights() []*Light {
+	white := color.RGBA{255, 255, 255, 255}
+
+	return []*Light{
+		NewAmbientLight(white, 0.5),
+		NewDirectionalLight(Vec3{1, -1, -1}, white, 0.5),
+	}
+}
+
+// CanCastShadows tells if the type of the light supports shadow mapping.
+func (l *Light) CanCastShadows() bool {
+	return l.Type == LightTypeDirectional || l.Type == LightTypeSpot
+}
+
+// prepare precalculates the values that do not change between vertices.
+// It must be called every time the light parameters are changed.
+func (l *Light) prepare() {
+	l.radiance = RGBFromColor(l.Color).Multiply(l.Intensity)
+
+	if l.Type == LightTypeDirectional || l.Type == LightTypeSpot {
+		l.towards = l.Direction.Multiply(-1).Normalize()
+	}
+
+	if l.Type == LightTypeSpot {
+		l.cosInner = cos32(l.InnerAngle)
+		l.cosOuter = cos32(max(l.OuterAngle, l.InnerAngle))
+	}
+}
+
+// Illuminate returns the light reaching a surface point with the given normal.
+// Both point and normal are expected to be in world space, normal must be normalized.
+func (l *Light) Illuminate(point, normal Vec3) RGB {
+	switch l.Type {
+	case LightTypeAmbient:
+		return l.radiance
+
+	case LightTypeDirectional:
+		return l.radiance.Multiply(max(normal.DotProduct(l.towards), 0))
+
+	case LightTypePoint, LightTypeSpot:
+		toLight := l.Position.Sub(point)
+		distance := toLight.Length()
+		if distance < lightEpsilon {
+			return RGB{} // the direction to the light is undefined
+		}
+
+		toLight = toLight.Divide(distance)
+
+		diffuse := normal.DotProduct(toLight)
+		if diffuse <= 0 {
+			return RGB{}
+		}
+
+		attenuation := 1 / (l.Constant + l.Linear*distance + l.Quadratic*distance*distance)
+
+		if l.Type == LightTypeSpot {
+			cosAngle := toLight.DotProduct(l.towards)
+			if cosAngle <= l.cosOuter {
+				return RGB{}
+			}
+
+			if cosAngle < l.cosInner {
+				t := (cosAngle - l.cosOuter) / (l.cosInner - l.cosOuter)
+				attenuation *= t * t * (3 - 2*t) // smoothstep
+			}
+		}
+
+		return l.radiance.Multiply(diffuse * attenuation)
+
+	default:
+		return RGB{}
+	}
+}
+
+// IlluminateShadowed is like Illuminate, but also takes the light’s shadow map into account.
+func (l *Light) IlluminateShadowed(point, normal Vec3) RGB {
+	light := l.Illuminate(point, normal)
+	if l.shadowMap == nil || light == (RGB{}) {
+		return light
+	}
+
+	towards := l.towards
+	if l.Type == LightTypeSpot {
+		towards = l.Position.Sub(point).Normalize()
+	}
+
+	// Surfaces at grazing angles to the light need a larger bias (slope-scaled bias)
+	cosAngle := max(normal.DotProduct(towards), 0.1)
+	slope := sqrt32(1-cosAngle*cosAngle) / cosAngle
+	biased := point.Add(towards.Multiply(l.ShadowBias * (1 + slope)))
+
+	return light.Multiply(l.shadowMap.Visibility(biased, l.ShadowPCF))
+}
+
+// illuminate sums up the contributions of the lights at the given world space point.
+func illuminate(lights []Light, point, normal Vec3) (total RGB) {
+	for i := range lights {
+		total = total.Add(lights[i].Illuminate(point, normal))
+	}
+
+	return total
+}
+
+// tangentBasis makes the tangent and the bitangent orthogonal to the normal (Gram-Schmidt),
+// keeping the handedness of the original basis.
+func tangentBasis(normal, tangent, bitangent Vec3) (Vec3, Vec3) {
+	tangent = tangent.Sub(normal.Multiply(normal.DotProduct(tangent)))
+	if tangent.Length() < 1e-6 {
+		return Vec3{}, Vec3{}
+	}
+
+	tangent = tangent.Normalize()
+	cross := normal.CrossProduct(tangent)
+
+	if cross.DotProduct(bitangent) < 0 {
+		return tangent, cross.Multiply(-1)
+	}
+
+	return tangent, cross
+}
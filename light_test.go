@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"image/color"
+	"math"
+	"testing"
+)
+
+var testLightColor = color.RGBA{255, 255, 255, 255}
+
+func TestLight_Illuminate(t *testing.T) {
+	up := Vec3{0, 1, 0}
+
+	// Unit intensity, so that the result is the diffuse factor times the attenuation
+	point := NewPointLight(Vec3{0, 2, 0}, testLightColor, 1)
+	point.Constant, point.Linear, point.Quadratic = 1, 0.5, 0.25
+
+	// Pointing down, the cone is 30 degrees wide inside and 60 degrees outside
+	spot := NewSpotLight(Vec3{0, 1, 0}, Vec3{0, -1, 0}, pi32/6, pi32/3, testLightColor, 1)
+	spot.Constant, spot.Linear, spot.Quadratic = 1, 0, 0
+
+	directional := NewDirectionalLight(Vec3{0, -1, -1}, testLightColor, 1)
+
+	// Smoothstep between the cosines of the cone angles at 45 degrees
+	edge := (sqrt32(0.5) - cos32(pi32/3)) / (cos32(pi32/6) - cos32(pi32/3))
+
+	tests := map[string]struct {
+		light         *Light
+		point, normal Vec3
+		want          float32
+	}{
+		"ambient": {
+			light:  NewAmbientLight(testLightColor, 0.5),
+			normal: Vec3{0, -1, 0},
+			want:   0.5,
+		},
+		"directional facing": {
+			light:  directional,
+			normal: Vec3{0, 1, 1}.Normalize(),
+			want:   1,
+		},
+		"directional at an angle": {
+			light:  directional,
+			normal: up,
+			want:   sqrt32(0.5),
+		},
+		"directional from behind": {
+			light:  directional,
+			normal: Vec3{0, 0, -1},
+			want:   0,
+		},
+		"point attenuation": {
+			light:  point,
+			normal: up,
+			want:   1 / (1 + 0.5*2 + 0.25*4),
+		},
+		"point attenuation far": {
+			light:  point,
+			point:  Vec3{0, -2, 0},
+			normal: up,
+			want:   1 / (1 + 0.5*4 + 0.25*16),
+		},
+		"point from behind": {
+			light:  point,
+			normal: Vec3{0, -1, 0},
+			want:   0,
+		},
+		"point at the light position": {
+			light:  point,
+			point:  point.Position,
+			normal: up,
+			want:   0,
+		},
+		"spot inside the cone": {
+			light:  spot,
+			point:  Vec3{0.2, 0, 0},
+			normal: Vec3{-0.2, 1, 0}.Normalize(),
+			want:   1,
+		},
+		"spot at the cone edge": {
+			// 45 degrees from the axis, between the inner and the outer angle
+			light:  spot,
+			point:  Vec3{1, 0, 0},
+			normal: Vec3{-1, 1, 0}.Normalize(),
+			want:   edge * edge * (3 - 2*edge),
+		},
+		"spot outside the cone": {
+			light:  spot,
+			point:  Vec3{3, 0, 0},
+			normal: Vec3{-3, 1, 0}.Normalize(),
+			want:   0,
+		},
+		"spot at the light position": {
+			light:  spot,
+			point:  spot.Position,
+			normal: up,
+			want:   0,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tt.light.prepare()
+			got := tt.light.Illuminate(tt.point, tt.normal)
+
+			if math.IsNaN(float64(got.R)) {
+				t.Fatalf("got NaN")
+			}
+
+			if got.R != got.G || got.G != got.B {
+				t.Fatalf("white light has changed color: %v", got)
+			}
+
+			if abs(got.R-tt.want) > 1e-5 {
+				t.Errorf("got %g, want %g", got.R, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSceneLight(t *testing.T) {
+	tests := map[string]struct {
+		data      string
+		color     color.RGBA
+		intensity float32
+		wantErr   bool
+	}{
+		"defaults":           {data: `{"type": "ambient"}`, color: testLightColor, intensity: 1},
+		"black":              {data: `{"type": "ambient", "color": [0, 0, 0]}`, color: color.RGBA{0, 0, 0, 255}, intensity: 1},
+		"zero intensity":     {data: `{"type": "point", "intensity": 0}`, color: testLightColor, intensity: 0},
+		"colored":            {data: `{"type": "point", "color": [255, 128, 0], "intensity": 2}`, color: color.RGBA{255, 128, 0, 255}, intensity: 2},
+		"negative intensity": {data: `{"type": "ambient", "intensity": -1}`, wantErr: true},
+		"unknown type":       {data: `{"type": "area"}`, wantErr: true},
+		"no direction":       {data: `{"type": "directional"}`, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var data SceneLightData
+			if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+				t.Fatal(err)
+			}
+
+			light, err := newSceneLight(&data)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("no error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if light.Color != tt.color || light.Intensity != tt.intensity {
+				t.Errorf("light is %v × %g, want %v × %g", light.Color, light.Intensity, tt.color, tt.intensity)
+			}
+		})
+	}
+}
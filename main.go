@@ -3,23 +3,22 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
+	"image/color"
 	"log"
 	"os"
 	"path"
 	"runtime"
 	"runtime/pprof"
+	"time"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 const (
-	downscaleFactor = 1
-	viewWidth       = 800 / downscaleFactor
-	viewHeight      = 600 / downscaleFactor
-	parallel        = true
-	frameRate       = 60
-	windowTitle     = "gorender"
-	demoMode        = true
+	parallel    = true
+	windowTitle = "gorender"
+	demoMode    = true
 )
 
 func onOff(b bool) string {
@@ -30,11 +29,71 @@ func onOff(b bool) string {
 	return "OFF"
 }
 
+// orbitLights rotates the scene lights around the vertical axis.
+func orbitLights(lights []*Light, angle float32) {
+	rotation := NewQuaternionFromAxisAngle(Vec3{0, 1, 0}, angle)
+
+	for _, light := range lights {
+		light.Position = rotation.Rotate(light.Position)
+		light.Direction = rotation.Rotate(light.Direction)
+	}
+}
+
+// frameRequest is the view state a frame is drawn with. It is copied to the drawing
+// goroutine, so that the main loop can change the view while the frame is drawn.
+type frameRequest struct {
+	camera        Camera
+	splitView     bool
+	width, height int // frame buffer size at the time of the request
+}
+
+// splitViewNames are the labels of the split view viewports, see splitViewports.
+var splitViewNames = [4]string{"top", "front", "side", "perspective"}
+
+// splitViewports returns the four-view layout: top, front and side orthographic views
+// of the sphere around the scene, and the perspective view of the camera. Viewports are
+// one pixel smaller than their cells, so the background shows as a border between them.
+func splitViewports(camera *Camera, center Vec3, radius float32, width, height int) []Viewport {
+	var (
+		cells     = SplitViewports(image.Rect(0, 0, width, height), 2, 2)
+		viewports = make([]Viewport, len(cells))
+		views     = [3]struct{ direction, up Vec3 }{
+			{Vec3{0, -1, 0}, Vec3{0, 0, -1}},
+			{Vec3{0, 0, -1}, Vec3{0, 1, 0}},
+			{Vec3{-1, 0, 0}, Vec3{0, 1, 0}},
+		}
+	)
+
+	for i, view := range views {
+		ortho := NewCamera(center.Sub(view.direction.Multiply(radius*2)), view.direction)
+		ortho.Name = splitViewNames[i]
+		ortho.Up = view.up
+		ortho.Projection = ProjectionOrthographic
+		ortho.OrthoExtent = radius * 1.1
+		ortho.Far = radius * 4
+		viewports[i].Camera = ortho
+	}
+
+	viewports[3].Camera = camera
+
+	for i, cell := range cells {
+		viewports[i].Rect = cell
+		viewports[i].Scissor = cell.Inset(1)
+	}
+
+	return viewports
+}
+
 type options struct {
 	blockProfile string
 	cpuProfile   string
 	memProfile   string
 	trace        string
+	depthMode    string
+	width        int
+	height       int
+	downscale    int
+	frameRate    int
 }
 
 func parseOptions() *options {
@@ -43,10 +102,20 @@ func parseOptions() *options {
 	flag.StringVar(&opts.cpuProfile, "cpuprof", "", "write cpu profile to file")
 	flag.StringVar(&opts.memProfile, "memprof", "", "write memory profile to file")
 	flag.StringVar(&opts.trace, "trace", "", "write trace to file")
+	flag.StringVar(&opts.depthMode, "depth", DepthReversed.String(), "depth buffer mode: reversed, standard or logarithmic")
+	flag.IntVar(&opts.width, "width", 800, "window width")
+	flag.IntVar(&opts.height, "height", 600, "window height")
+	flag.IntVar(&opts.downscale, "downscale", 1, "render at the window size divided by the factor")
+	flag.IntVar(&opts.frameRate, "fps", 60, "target frame rate")
 	flag.Parse()
 	return opts
 }
 
+// viewSize returns the frame buffer size for the window size.
+func (opts *options) viewSize(windowWidth, windowHeight int) (width, height int) {
+	return max(windowWidth/opts.downscale, 1), max(windowHeight/opts.downscale, 1)
+}
+
 func drawText(x, y int32, text string) {
 	rl.DrawText(text, x+1, y+1, 10, rl.Black)
 	rl.DrawText(text, x, y, 10, rl.White)
@@ -59,6 +128,10 @@ func main() {
 		log.Fatalf("usage: %s [options] filename.obj", os.Args[0])
 	}
 
+	if opts.width <= 0 || opts.height <= 0 || opts.downscale <= 0 || opts.frameRate <= 0 {
+		log.Fatalf("-width, -height, -downscale and -fps must be positive")
+	}
+
 	if opts.blockProfile != "" {
 		runtime.SetBlockProfileRate(1)
 
@@ -142,8 +215,11 @@ func main() {
 		}()
 	}
 
-	fb := NewFrameBuffer(viewWidth, viewHeight)
+	fb := NewFrameBuffer(opts.viewSize(opts.width, opts.height))
 	renderer := NewRenderer(fb)
+	renderer.Picking = true
+	renderer.ClipCaps = true
+	renderer.ClipCapColor = color.RGBA{200, 70, 50, 255}
 	filename := flag.Arg(0)
 
 	var (
@@ -151,6 +227,10 @@ func main() {
 		err   error
 	)
 
+	if renderer.DepthMode, err = ParseDepthMode(opts.depthMode); err != nil {
+		log.Fatalf("invalid -depth option: %s", err)
+	}
+
 	switch path.Ext(filename) {
 	case ".obj":
 		meshes, err := LoadMeshFile(filename, false)
@@ -158,7 +238,7 @@ func main() {
 			log.Fatalf("failed to load mesh file: %s", err)
 		}
 
-		scene = &Scene{}
+		scene = &Scene{Lights: DefaultLights(), Fog: DefaultFog()}
 		for i := range meshes {
 			object := NewObject(meshes[i])
 			scene.Objects = append(scene.Objects, object)
@@ -173,58 +253,126 @@ func main() {
 	}
 
 	var (
-		windowWidth  = int32(fb.Width * downscaleFactor)
-		windowHeight = int32(fb.Height * downscaleFactor)
+		downscale    = opts.downscale
 		numVertices  = scene.NumVertices()
 		numTriangles = scene.NumTriangles()
 		oumObjects   = scene.NumObjects()
 	)
 
 	rl.SetTraceLogLevel(rl.LogError) // Make raylib less verbose
-	rl.InitWindow(windowWidth, windowHeight, windowTitle)
+	rl.SetConfigFlags(rl.FlagWindowResizable)
+	rl.InitWindow(int32(opts.width), int32(opts.height), windowTitle)
 	defer rl.CloseWindow()
 
-	rl.SetTargetFPS(frameRate)
+	rl.SetWindowMinSize(downscale, downscale)
+	rl.SetTargetFPS(int32(opts.frameRate))
 
+	// The texture is recreated when the window is resized
 	renderTexture := rl.LoadRenderTexture(int32(fb.Width), int32(fb.Height))
-	defer rl.UnloadRenderTexture(renderTexture)
+	defer func() {
+		rl.UnloadRenderTexture(renderTexture)
+	}()
 
-	camera := &Camera{
-		Direction: Vec3{0, 0, -1},
-		Position:  Vec3{0, 0, 5},
-		Up:        Vec3{0, 1, 0},
+	cameras := scene.Cameras
+	if len(cameras) == 0 {
+		cameras = []*Camera{NewCamera(Vec3{0, 0, 5}, Vec3{0, 0, -1})}
+		cameras[0].Name = "default"
 	}
 
-	triggerDraw := make(chan struct{})
+	// Scene cameras are copied, so that moving around does not change them
+	camera := new(Camera)
+	*camera = *cameras[0]
+
+	splitView := false
+	triggerDraw := make(chan frameRequest)
 	frameReady := make(chan struct{})
 
 	go func() {
-		for {
-			<-triggerDraw
-			cameraCopy := *camera // to prevent updating camera mid-frame
-			renderer.Draw(scene.Objects, &cameraCopy)
+		for req := range triggerDraw {
+			if req.splitView {
+				center, radius := sceneBounds(scene.Objects)
+				renderer.DrawViewports(scene, splitViewports(&req.camera, center, radius, req.width, req.height))
+			} else {
+				renderer.Draw(scene, &req.camera)
+			}
+
 			frameReady <- struct{}{}
 		}
 	}()
 
-	triggerDraw <- struct{}{}
+	triggerDraw <- frameRequest{camera: *camera, splitView: splitView, width: fb.Width, height: fb.Height}
 
 	if !demoMode {
 		rl.DisableCursor()
 	}
 
 	var (
-		lastCursorX = rl.GetMouseX()
-		lastCursorY = rl.GetMouseY()
+		lastCursorX   = rl.GetMouseX()
+		lastCursorY   = rl.GetMouseY()
+		exportGBuffer = false
+		picked        *PickResult
+		cameraIndex   = 0
+		projection    = int(camera.Projection) // index in projectionPresets
+		sectionAxis   = 0                      // index in sectionAxes, 0 is no section
+		sectionOffset = float32(0)
 	)
 
+	projectionPresets := []string{"perspective", "orthographic", "isometric", "dimetric"}
+
+	// The section plane cuts away the part of the scene on the positive side of the axis
+	sectionAxes := []Vec3{{}, {1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	sectionNames := []string{"off", "x", "y", "z"}
+
 	for !rl.WindowShouldClose() {
 		<-frameReady
+
+		// The renderer is idle between the frames, so it can be resized. The frame drawn
+		// at the old size is dropped.
+		if rl.IsWindowResized() {
+			width, height := opts.viewSize(rl.GetScreenWidth(), rl.GetScreenHeight())
+
+			if width != fb.Width || height != fb.Height {
+				renderer.Resize(width, height)
+				picked = nil
+
+				rl.UnloadRenderTexture(renderTexture)
+				renderTexture = rl.LoadRenderTexture(int32(width), int32(height))
+			}
+		}
+
 		fb.SwapBuffers()
+
+		// The G-buffer can only be read between the frames
+		if exportGBuffer {
+			if err := renderer.ExportGBuffer("."); err != nil {
+				log.Printf("[ERROR] failed to export G-buffer: %s", err)
+			} else {
+				log.Printf("[INFO] G-buffer exported")
+			}
+
+			exportGBuffer = false
+		}
+
+		// Pick the object under the cross-hair, or under the cursor in demo mode
+		if rl.IsMouseButtonPressed(rl.MouseLeftButton) {
+			x, y := fb.Width/2, fb.Height/2
+			if demoMode {
+				x, y = int(rl.GetMouseX())/downscale, int(rl.GetMouseY())/downscale
+			}
+
+			picked = nil
+			renderer.Highlighted = nil
+
+			if result, ok := renderer.Pick(x, y); ok {
+				picked = &result
+				renderer.Highlighted = result.Object
+			}
+		}
+
 		framesPerSecond := int(rl.GetFPS())
 		trianglesPerFrame := renderer.TPF
 		trianglesPerSecond := (trianglesPerFrame * framesPerSecond) / 1000
-		triggerDraw <- struct{}{}
+		tileStats := renderer.TileStats()
 
 		if demoMode {
 			for _, obj := range scene.Objects {
@@ -251,6 +399,12 @@ func main() {
 		case rl.IsKeyDown(rl.KeyDown):
 			camera.Position.Y -= 0.05
 
+		// Arrow keys to move the lights around the scene
+		case rl.IsKeyDown(rl.KeyLeft):
+			orbitLights(scene.Lights, -0.03)
+		case rl.IsKeyDown(rl.KeyRight):
+			orbitLights(scene.Lights, 0.03)
+
 		// Render options
 		case rl.IsKeyPressed(rl.KeyB):
 			renderer.BackfaceCulling = !renderer.BackfaceCulling
@@ -270,6 +424,100 @@ func main() {
 			renderer.ShowTextures = !renderer.ShowTextures
 		case rl.IsKeyPressed(rl.KeyI):
 			renderer.FlatShading = !renderer.FlatShading
+		case rl.IsKeyPressed(rl.KeyH):
+			renderer.Shadows = !renderer.Shadows
+
+		// Fog mode and thickness
+		case rl.IsKeyPressed(rl.KeyG):
+			scene.Fog.Mode = (scene.Fog.Mode + 1) % (FogModeExponentialSquared + 1)
+		case rl.IsKeyDown(rl.KeyLeftBracket):
+			scene.Fog.Density = max(scene.Fog.Density-0.002, 0)
+			scene.Fog.End += 0.2
+		case rl.IsKeyDown(rl.KeyRightBracket):
+			scene.Fog.Density += 0.002
+			scene.Fog.End = max(scene.Fog.End-0.2, scene.Fog.Start+0.2)
+
+		// HDR, tone mapping and exposure
+		case rl.IsKeyPressed(rl.KeyN):
+			renderer.HDR = !renderer.HDR
+		case rl.IsKeyPressed(rl.KeyM):
+			renderer.ToneMapping = (renderer.ToneMapping + 1) % (ToneMappingACES + 1)
+		case rl.IsKeyDown(rl.KeyMinus):
+			renderer.Exposure = max(renderer.Exposure-0.02, 0)
+		case rl.IsKeyDown(rl.KeyEqual):
+			renderer.Exposure += 0.02
+		case rl.IsKeyPressed(rl.KeyK):
+			renderer.GammaCorrection = !renderer.GammaCorrection
+
+		// Deferred shading
+		case rl.IsKeyPressed(rl.KeyR):
+			renderer.Deferred = !renderer.Deferred
+		case rl.IsKeyPressed(rl.KeyF12):
+			exportGBuffer = renderer.Deferred
+		case rl.IsKeyPressed(rl.KeyO):
+			renderer.SSAO = !renderer.SSAO
+		case rl.IsKeyPressed(rl.KeyP):
+			renderer.PostProcessing = !renderer.PostProcessing
+		case rl.IsKeyPressed(rl.KeyU):
+			renderer.Toon = !renderer.Toon
+		case rl.IsKeyPressed(rl.KeyQ):
+			renderer.DebugView = (renderer.DebugView + 1) % (DebugViewOverdraw + 1)
+		case rl.IsKeyPressed(rl.KeyY):
+			renderer.TileOverlay = (renderer.TileOverlay + 1) % (TileOverlayTime + 1)
+
+		// Cameras and projections
+		case rl.IsKeyPressed(rl.KeyJ):
+			cameraIndex = (cameraIndex + 1) % len(cameras)
+			*camera = *cameras[cameraIndex]
+			projection = int(camera.Projection)
+		case rl.IsKeyPressed(rl.KeyZ):
+			projection = (projection + 1) % len(projectionPresets)
+			target := camera.Position.Add(forward.Multiply(5))
+
+			var preset *Camera
+
+			switch projectionPresets[projection] {
+			case "perspective":
+				camera.Projection = ProjectionPerspective
+			case "orthographic":
+				camera.Projection = ProjectionOrthographic
+			case "isometric":
+				preset = NewIsometricCamera(target, 5)
+			case "dimetric":
+				preset = NewDimetricCamera(target, 5)
+			}
+
+			if preset != nil {
+				camera.Position, camera.Direction, camera.Up = preset.Position, preset.Direction, preset.Up
+				camera.Projection = preset.Projection
+			}
+
+		// Four-view layout
+		case rl.IsKeyPressed(rl.KeyTwo):
+			splitView = !splitView
+
+		// Section plane axis and position
+		case rl.IsKeyPressed(rl.KeyOne):
+			sectionAxis = (sectionAxis + 1) % len(sectionAxes)
+		case rl.IsKeyDown(rl.KeyComma):
+			sectionOffset -= 0.05
+		case rl.IsKeyDown(rl.KeyPeriod):
+			sectionOffset += 0.05
+		}
+
+		// The renderer is idle until the next frame is triggered, so the planes are updated in place
+		renderer.ClipPlanes = renderer.ClipPlanes[:0]
+		if axis := sectionAxes[sectionAxis]; sectionAxis != 0 {
+			renderer.ClipPlanes = append(renderer.ClipPlanes, NewClipPlane(axis.Multiply(sectionOffset), axis.Multiply(-1)))
+		}
+
+		// Mouse wheel zooms the view
+		if wheel := rl.GetMouseWheelMove(); wheel != 0 {
+			if camera.Projection == ProjectionOrthographic {
+				camera.OrthoExtent = max(camera.OrthoExtent*(1-0.1*wheel), 0.5)
+			} else {
+				camera.FOV = min(max(camera.FOV*(1-0.1*wheel), 10*(pi32/180)), 120*(pi32/180))
+			}
 		}
 
 		if !demoMode {
@@ -292,17 +540,24 @@ func main() {
 			lastCursorY = cursorY
 		}
 
+		// The scene, the lights and the camera are only changed between the frames, the next
+		// frame is drawn while the previous one is shown
+		triggerDraw <- frameRequest{camera: *camera, splitView: splitView, width: fb.Width, height: fb.Height}
+
 		// Copy the frame buffer to the render texture
 		rl.BeginTextureMode(renderTexture)
 		rl.UpdateTexture(renderTexture.Texture, fb.Pixels2)
 		rl.EndTextureMode()
 
 		// Draw the render texture to the screen
+		windowHeight := int32(rl.GetScreenHeight())
+
 		rl.BeginDrawing()
+		rl.ClearBackground(rl.Black) // the window is not a multiple of the downscale factor
 		rl.DrawTexturePro(
 			renderTexture.Texture,
 			rl.NewRectangle(0, 0, float32(fb.Width), float32(fb.Height)),
-			rl.NewRectangle(0, 0, float32(fb.Width*downscaleFactor), float32(fb.Height*downscaleFactor)),
+			rl.NewRectangle(0, 0, float32(fb.Width*downscale), float32(fb.Height*downscale)),
 			rl.NewVector2(0, 0),
 			0,
 			rl.White,
@@ -312,12 +567,44 @@ func main() {
 		drawText(5, 15, fmt.Sprintf("objects: %d", oumObjects))
 		drawText(5, 25, fmt.Sprintf("vertices: %d", numVertices))
 		drawText(5, 35, fmt.Sprintf("triangles: %d", numTriangles))
+		drawText(5, 45, fmt.Sprintf("lights: %d", len(scene.Lights)))
+		drawText(5, 55, fmt.Sprintf("fog: %s (density %.3f, end %.1f)", scene.Fog.Mode, scene.Fog.Density, scene.Fog.End))
+		drawText(5, 65, fmt.Sprintf("tone mapping: %s (exposure %.2f)", renderer.ToneMapping, renderer.Exposure))
+		drawText(5, 75, fmt.Sprintf("debug view [q]: %s", renderer.DebugView))
+		drawText(5, 85, fmt.Sprintf("tile overla[y]: %s", renderer.TileOverlay))
+		drawText(5, 95, fmt.Sprintf(
+			"camera [j]: %s, projection [z]: %s (fov %.0f deg, extent %.1f, near %.2f, far %.0f)",
+			camera.Name, projectionPresets[projection], camera.FOV*(180/pi32), camera.OrthoExtent, camera.Near, camera.Far,
+		))
+
+		drawText(5, 105, fmt.Sprintf("section [1]: %s, offset [,/.]: %.2f, split view [2]: %s", sectionNames[sectionAxis], sectionOffset, onOff(splitView)))
+
+		if picked != nil {
+			drawText(5, 115, fmt.Sprintf(
+				"picked: %s, face %d at X=%.2f Y=%.2f Z=%.2f, depth %.2f",
+				picked.Object.Name, picked.Face, picked.Position.X, picked.Position.Y, picked.Position.Z, picked.Depth,
+			))
+		}
+
+		if splitView {
+			for i, cell := range SplitViewports(image.Rect(0, 0, fb.Width, fb.Height), 2, 2) {
+				drawText(int32(cell.Max.X*downscale)-80, int32(cell.Min.Y*downscale)+5, splitViewNames[i])
+			}
+		}
+
+		if renderer.TileOverlay != TileOverlayNone {
+			for _, s := range tileStats {
+				x, y := int32(s.X0*downscale)+5, int32(s.Y1*downscale)-25
+				drawText(x, y, fmt.Sprintf("%d tris, %d frags", s.Triangles, s.Fragments))
+				drawText(x, y+10, (s.RasterTime + s.ShadeTime).Round(time.Microsecond).String())
+			}
+		}
 
 		drawText(
 			5,
 			windowHeight-15,
 			fmt.Sprintf(
-				"[V]erticies: %s [E]dges: %s [F]aces: %s, [L]ights: %s, [B]ackface culling: %s, [C]lipping: %s, [T]extures: %s, Flat Shad[i]ng: %s",
+				"[V]erticies: %s [E]dges: %s [F]aces: %s, [L]ights: %s, [B]ackface culling: %s, [C]lipping: %s, [T]extures: %s, Flat Shad[i]ng: %s, S[h]adows: %s, Fo[g]: %s, HDR [n]: %s, sRGB [k]: %s, Defe[r]red: %s, SSA[o]: %s, [P]ost: %s, Too[u]n: %s",
 				onOff(renderer.ShowVertices),
 				onOff(renderer.ShowEdges),
 				onOff(renderer.ShowFaces),
@@ -326,12 +613,20 @@ func main() {
 				onOff(renderer.FrustumClipping),
 				onOff(renderer.ShowTextures),
 				onOff(renderer.FlatShading),
+				onOff(renderer.Shadows),
+				scene.Fog.Mode,
+				onOff(renderer.HDR),
+				onOff(renderer.GammaCorrection),
+				onOff(renderer.Deferred),
+				onOff(renderer.SSAO),
+				onOff(renderer.PostProcessing),
+				onOff(renderer.Toon),
 			),
 		)
 
 		for _, info := range renderer.DebugInfo {
-			rl.DrawText(info.Text, int32(info.X*downscaleFactor)+1, int32(info.Y*downscaleFactor)+1, 12, rl.Black)
-			rl.DrawText(info.Text, int32(info.X*downscaleFactor), int32(info.Y*downscaleFactor), 12, rl.Yellow)
+			rl.DrawText(info.Text, int32(info.X*downscale)+1, int32(info.Y*downscale)+1, 12, rl.Black)
+			rl.DrawText(info.Text, int32(info.X*downscale), int32(info.Y*downscale), 12, rl.Yellow)
 		}
 
 		drawText(
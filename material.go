@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+)
+
+// CullMode selects which sides of the faces are not drawn.
+type CullMode int
+
+const (
+	CullBack  CullMode = iota // faces seen from behind are skipped
+	CullFront                 // faces seen from the front are skipped
+	CullNone                  // both sides are drawn, the back side is lit with the flipped normal
+)
+
+func (m CullMode) String() string {
+	switch m {
+	case CullBack:
+		return "back"
+	case CullFront:
+		return "front"
+	case CullNone:
+		return "none"
+	default:
+		return fmt.Sprintf("CullMode(%d)", int(m))
+	}
+}
+
+func ParseCullMode(s string) (CullMode, error) {
+	for m := CullBack; m <= CullNone; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+
+	return CullBack, fmt.Errorf("unknown cull mode: %s", s)
+}
+
+// Winding is the order of the face vertices when looking at the front side.
+type Winding int
+
+const (
+	WindingCounterClockwise Winding = iota
+	WindingClockwise
+)
+
+func (w Winding) String() string {
+	switch w {
+	case WindingCounterClockwise:
+		return "ccw"
+	case WindingClockwise:
+		return "cw"
+	default:
+		return fmt.Sprintf("Winding(%d)", int(w))
+	}
+}
+
+func ParseWinding(s string) (Winding, error) {
+	for w := WindingCounterClockwise; w <= WindingClockwise; w++ {
+		if w.String() == s {
+			return w, nil
+		}
+	}
+
+	return WindingCounterClockwise, fmt.Errorf("unknown winding: %s", s)
+}
+
+// Material describes how the surface of a face looks.
+type Material struct {
+	Name      string
+	Texture   *Texture // diffuse color
+	NormalMap *Texture // tangent space normals, optional
+
+	// Reflectivity is the share of the environment color in the final color, 0..1.
+	// Reflections are only visible when the scene has an environment.
+	Reflectivity float32
+
+	// CullMode and Winding define the front side of the faces and which sides are drawn.
+	// Face normals are calculated for the counter-clockwise winding and flipped otherwise.
+	CullMode CullMode
+	Winding  Winding
+}
+
+func NewMaterial(name string, texture *Texture) *Material {
+	return &Material{
+		Name:    name,
+		Texture: texture,
+	}
+}
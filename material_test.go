@@ -0,0 +1,132 @@
+package main
+
+import (
+	"image/color"
+	"path"
+	"testing"
+)
+
+func TestRenderer_NormalMap(t *testing.T) {
+	const width, height = 32, 24
+
+	// Lit at an angle from the left, brighter where the normal leans to the left
+	light := NewDirectionalLight(Vec3{0.6, 0, -0.8}, color.RGBA{255, 255, 255, 255}, 1)
+
+	draw := func(normalMap *Texture) color.RGBA {
+		material := NewMaterial("wall", NewColorTexture(color.RGBA{255, 255, 255, 255}))
+		material.NormalMap = normalMap
+
+		scene := &Scene{
+			Objects: []*Object{setMaterial(newQuadObject(Vec3{0, 0, -3}, Vec3{0, 0, 1}, 2), material)},
+			Lights:  []*Light{light},
+		}
+
+		renderer := newTestRenderer(width, height)
+		renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+		return renderer.fb.Pixels[height/2*width+width/2]
+	}
+
+	var (
+		plain     = draw(nil)
+		flat      = draw(NewColorTexture(color.RGBA{128, 128, 255, 255}))
+		towards   = draw(NewColorTexture(color.RGBA{37, 128, 218, 255}))
+		away      = draw(NewColorTexture(color.RGBA{218, 128, 218, 255}))
+		tolerance = 2
+	)
+
+	// The light falls at cos = 0.8, which is 231 in sRGB
+	if plain.R != 231 {
+		t.Errorf("without normal map the wall is %v, want 231", plain)
+	}
+
+	if abs(int(flat.R)-int(plain.R)) > tolerance {
+		t.Errorf("flat normal map changed the lighting from %v to %v", plain, flat)
+	}
+
+	if towards.R <= plain.R+10 {
+		t.Errorf("normal tilted towards the light gives %v, want brighter than %v", towards, plain)
+	}
+
+	if away.R >= plain.R-10 {
+		t.Errorf("normal tilted away from the light gives %v, want darker than %v", away, plain)
+	}
+}
+
+func TestRenderer_CullMode(t *testing.T) {
+	const width, height = 64, 48
+
+	var (
+		front  = NewCamera(Vec3{0, 0, 0}, Vec3{0, 0, -1})
+		behind = NewCamera(Vec3{0, 0, -10}, Vec3{0, 0, 1})
+	)
+
+	tests := map[string]struct {
+		cullMode CullMode
+		winding  Winding
+		camera   *Camera
+		visible  bool
+	}{
+		"cull back, front side":    {cullMode: CullBack, camera: front, visible: true},
+		"cull back, back side":     {cullMode: CullBack, camera: behind, visible: false},
+		"cull front, front side":   {cullMode: CullFront, camera: front, visible: false},
+		"cull front, back side":    {cullMode: CullFront, camera: behind, visible: true},
+		"double-sided, front side": {cullMode: CullNone, camera: front, visible: true},
+		"double-sided, back side":  {cullMode: CullNone, camera: behind, visible: true},
+		"clockwise, front side":    {cullMode: CullBack, winding: WindingClockwise, camera: front, visible: false},
+		"clockwise, back side":     {cullMode: CullBack, winding: WindingClockwise, camera: behind, visible: true},
+		"clockwise cull front":     {cullMode: CullFront, winding: WindingClockwise, camera: front, visible: true},
+		"clockwise double-sided":   {cullMode: CullNone, winding: WindingClockwise, camera: behind, visible: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			material := NewMaterial("white", NewColorTexture(color.RGBA{255, 255, 255, 255}))
+			material.CullMode = tt.cullMode
+			material.Winding = tt.winding
+
+			object := setMaterial(newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 4), material)
+
+			// Only lit from the side the camera is looking at, so the visible side has to
+			// be shaded with the normal facing the camera
+			scene := &Scene{
+				Objects: []*Object{object},
+				Lights:  []*Light{NewDirectionalLight(tt.camera.Direction, color.RGBA{255, 255, 255, 255}, 1)},
+			}
+
+			renderer := newTestRenderer(width, height)
+			renderer.Picking = true
+			renderer.Draw(scene, tt.camera)
+
+			_, visible := renderer.Pick(width/2, height/2)
+			if visible != tt.visible {
+				t.Fatalf("visible is %t, want %t", visible, tt.visible)
+			}
+
+			if c := renderer.fb.Pixels[height/2*width+width/2]; visible && c.R < 200 {
+				t.Errorf("visible side is not lit: %v", c)
+			}
+		})
+	}
+}
+
+func TestLoadSceneFile_CullModeErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown cull mode": `{"id": "triangle", "objFile": "triangle.obj", "cullMode": "both"}`,
+		"unknown winding":   `{"id": "triangle", "objFile": "triangle.obj", "winding": "left"}`,
+	}
+
+	for name, mesh := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := writeSceneFiles(t, map[string]string{
+				"triangle.obj": testSceneTriangle,
+				"triangle.mtl": "newmtl red\n",
+				"scene.json":   `{"meshes": [` + mesh + `], "objects": [{"meshID": "triangle", "scale": [1, 1, 1]}]}`,
+			})
+
+			if _, err := LoadSceneFile(path.Join(dir, "scene.json")); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
@@ -23,3 +23,19 @@ func cos32(x float32) float32 {
 func tan32(x float32) float32 {
 	return float32(math.Tan(float64(x)))
 }
+
+func exp32(x float32) float32 {
+	return float32(math.Exp(float64(x)))
+}
+
+func log32(x float32) float32 {
+	return float32(math.Log(float64(x)))
+}
+
+func round32(x float32) float32 {
+	return float32(math.Round(float64(x)))
+}
+
+func floor32(x float32) float32 {
+	return float32(math.Floor(float64(x)))
+}
@@ -87,32 +87,65 @@ func NewWorldMatrix(scale, rotation, translation Vec3) Matrix {
 	return m
 }
 
-// NewPerspectiveMatrix returns a perspective projection matrix that transforms
-// world coordinates to clip coordinates.
-func NewPerspectiveMatrix(fov, aspect, zNear, zFar float32) Matrix {
+// NewPerspectiveCameraMatrix returns the perspective projection of the camera. View space
+// depth grows along the camera direction, W is equal to the depth, and Z maps to 0..W between
+// the near and far planes, or to W..0 if the depth is reversed, see DepthMode. The view space
+// X axis points to the left and Y up, while the screen X axis points to the right and Y down,
+// so both are negated.
+func NewPerspectiveCameraMatrix(fov, aspect, zNear, zFar float32, reversed bool) Matrix {
 	tanHalfFov := tan32(fov / 2.0)
 
-	m00 := 1 / (aspect * tanHalfFov)
-	m11 := 1 / tanHalfFov
-	m22 := (zFar + zNear) / (zNear - zFar)
-	m23 := (2 * zFar * zNear) / (zNear - zFar)
+	m22 := zFar / (zFar - zNear)
+	m23 := -zFar * zNear / (zFar - zNear)
+
+	if reversed {
+		m22 = -zNear / (zFar - zNear)
+		m23 = zFar * zNear / (zFar - zNear)
+	}
+
+	return Matrix{
+		{-1 / (aspect * tanHalfFov), 0, 0, 0},
+		{0, -1 / tanHalfFov, 0, 0},
+		{0, 0, m22, m23},
+		{0, 0, 1, 0},
+	}
+}
+
+// NewOrthographicCameraMatrix is the orthographic counterpart of NewPerspectiveCameraMatrix,
+// following the same axis and depth conventions with W equal to 1. Extent is the half height
+// of the view volume in world units.
+func NewOrthographicCameraMatrix(extent, aspect, zNear, zFar float32, reversed bool) Matrix {
+	m22 := 1 / (zFar - zNear)
+	m23 := -zNear / (zFar - zNear)
+
+	if reversed {
+		m22 = -1 / (zFar - zNear)
+		m23 = zFar / (zFar - zNear)
+	}
 
 	return Matrix{
-		{m00, 0, 0, 0},
-		{0, m11, 0, 0},
-		{0, 0, -m22, -m23},
-		{0, 0, -1, 0},
+		{-1 / (extent * aspect), 0, 0, 0},
+		{0, -1 / extent, 0, 0},
+		{0, 0, m22, m23},
+		{0, 0, 0, 1},
 	}
 }
 
 func NewScreenMatrix(width, height int) Matrix {
+	return NewViewportMatrix(0, 0, width, height)
+}
+
+// NewViewportMatrix maps the normalized device coordinates to the screen
+// rectangle with the top-left corner at (x, y). Z is kept as is, the projection
+// matrices map it to 0..1 already.
+func NewViewportMatrix(x, y, width, height int) Matrix {
 	hw := float32(width) / 2
 	hh := float32(height) / 2
 
 	return Matrix{
-		{hw, 0, 0, hw},
-		{0, hh, 0, hh},
-		{0, 0, 0.5, 0.5},
+		{hw, 0, 0, float32(x) + hw},
+		{0, hh, 0, float32(y) + hh},
+		{0, 0, 1, 0},
 		{0, 0, 0, 1},
 	}
 }
@@ -13,7 +13,7 @@ type Face struct {
 	VertexIndices [3]int
 	NormalIndices [3]int
 	UVs           [3]UV
-	Texture       *Texture
+	Material      *Material
 }
 
 type Mesh struct {
@@ -21,6 +21,8 @@ type Mesh struct {
 	Vertices      []Vec4
 	VertexNormals []Vec4
 	FaceNormals   []Vec4
+	Tangents      []Vec4 // per vertex, used for normal mapping
+	Bitangents    []Vec4 // per vertex, used for normal mapping
 	BoundingBox   [8]Vec4
 	Faces         []Face
 }
@@ -50,6 +52,54 @@ func boundingBox(vertices []Vec4) [8]Vec4 {
 	}
 }
 
+// calculateTangents returns per-vertex tangents and bitangents, pointing in the direction
+// of increasing U and V texture coordinates respectively. Values of the faces sharing the
+// vertex are averaged.
+func calculateTangents(vertices []Vec4, faces []Face) (tangents, bitangents []Vec4) {
+	tangents = make([]Vec4, len(vertices))
+	bitangents = make([]Vec4, len(vertices))
+
+	for i := range faces {
+		face := &faces[i]
+
+		v0 := vertices[face.VertexIndices[0]]
+		v1 := vertices[face.VertexIndices[1]]
+		v2 := vertices[face.VertexIndices[2]]
+		edge1, edge2 := v1.Sub(v0), v2.Sub(v0)
+
+		du1 := face.UVs[1].U - face.UVs[0].U
+		dv1 := face.UVs[1].V - face.UVs[0].V
+		du2 := face.UVs[2].U - face.UVs[0].U
+		dv2 := face.UVs[2].V - face.UVs[0].V
+
+		det := du1*dv2 - du2*dv1
+		if abs(det) < 1e-9 {
+			continue // no texture coordinates or degenerate mapping
+		}
+
+		tangent := edge1.Multiply(dv2).Sub(edge2.Multiply(dv1)).Divide(det)
+		bitangent := edge2.Multiply(du1).Sub(edge1.Multiply(du2)).Divide(det)
+		tangent.W, bitangent.W = 0, 0
+
+		for _, vi := range face.VertexIndices {
+			tangents[vi] = tangents[vi].Add(tangent)
+			bitangents[vi] = bitangents[vi].Add(bitangent)
+		}
+	}
+
+	for i := range tangents {
+		if tangents[i] != (Vec4{}) {
+			tangents[i] = tangents[i].Normalize()
+		}
+
+		if bitangents[i] != (Vec4{}) {
+			bitangents[i] = bitangents[i].Normalize()
+		}
+	}
+
+	return tangents, bitangents
+}
+
 func NewMesh(vertices []Vec4, vertexNormals []Vec4, faces []Face) *Mesh {
 	faceNormals := make([]Vec4, len(faces))
 	for i := range faces {
@@ -57,13 +107,18 @@ func NewMesh(vertices []Vec4, vertexNormals []Vec4, faces []Face) *Mesh {
 		v1 := vertices[faces[i].VertexIndices[1]].ToVec3()
 		v2 := vertices[faces[i].VertexIndices[2]].ToVec3()
 		faceNormals[i] = v1.Sub(v0).CrossProduct(v2.Sub(v0)).Normalize().ToVec4()
+		faceNormals[i].W = 0 // directions are not affected by translation
 	}
 
+	tangents, bitangents := calculateTangents(vertices, faces)
+
 	return &Mesh{
 		Faces:         faces,
 		Vertices:      vertices,
 		VertexNormals: vertexNormals,
 		FaceNormals:   faceNormals,
+		Tangents:      tangents,
+		Bitangents:    bitangents,
 		BoundingBox:   boundingBox(vertices),
 	}
 }
@@ -74,8 +129,20 @@ type Object struct {
 	Translation         Vec3
 	Scale               Vec3
 	TransformedVertices []Vec4
+	WorldVertices       []Vec4
 	WorldVertexNormals  []Vec4
 	WorldFaceNormals    []Vec4
+	WorldTangents       []Vec4
+	WorldBitangents     []Vec4
+	CastShadows         bool
+	ReceiveShadows      bool
+
+	// DepthBias moves the object towards the camera in the depth test, so that coplanar
+	// overlays such as decals are drawn over the surface under them. The constant bias is
+	// in steps of the depth buffer precision, and the slope-scaled bias is multiplied by the
+	// change of the depth per pixel, which is larger for surfaces seen at grazing angles.
+	DepthBias      float32
+	SlopeDepthBias float32
 }
 
 func NewObject(mesh *Mesh) *Object {
@@ -83,8 +150,13 @@ func NewObject(mesh *Mesh) *Object {
 		Mesh:                mesh,
 		Scale:               Vec3{1, 1, 1},
 		TransformedVertices: make([]Vec4, len(mesh.Vertices)),
+		WorldVertices:       make([]Vec4, len(mesh.Vertices)),
 		WorldFaceNormals:    make([]Vec4, len(mesh.FaceNormals)),
 		WorldVertexNormals:  make([]Vec4, len(mesh.VertexNormals)),
+		WorldTangents:       make([]Vec4, len(mesh.Tangents)),
+		WorldBitangents:     make([]Vec4, len(mesh.Bitangents)),
+		CastShadows:         true,
+		ReceiveShadows:      true,
 	}
 }
 
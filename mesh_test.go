@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCalculateTangents(t *testing.T) {
+	tests := map[string]struct {
+		normal             Vec3
+		tangent, bitangent Vec4
+	}{
+		"facing +Z": {
+			normal:    Vec3{0, 0, 1},
+			tangent:   Vec4{1, 0, 0, 0},
+			bitangent: Vec4{0, 1, 0, 0},
+		},
+		"facing +Y": {
+			normal:    Vec3{0, 1, 0},
+			tangent:   Vec4{1, 0, 0, 0},
+			bitangent: Vec4{0, 0, -1, 0},
+		},
+		"facing -X": {
+			normal:    Vec3{-1, 0, 0},
+			tangent:   Vec4{0, 0, 1, 0},
+			bitangent: Vec4{0, 1, 0, 0},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			quad := newQuadObject(Vec3{1, 2, 3}, tt.normal, 2)
+
+			for i := range quad.Vertices {
+				if quad.Tangents[i].Sub(tt.tangent).Length() > 1e-5 {
+					t.Errorf("tangent of vertex %d is %v, want %v", i, quad.Tangents[i], tt.tangent)
+				}
+
+				if quad.Bitangents[i].Sub(tt.bitangent).Length() > 1e-5 {
+					t.Errorf("bitangent of vertex %d is %v, want %v", i, quad.Bitangents[i], tt.bitangent)
+				}
+			}
+		})
+	}
+}
@@ -12,8 +12,9 @@ import (
 )
 
 type ObjMaterial struct {
-	Name  string
-	MapKd string
+	Name    string
+	MapKd   string
+	MapBump string
 }
 
 type ObjContext struct {
@@ -21,7 +22,7 @@ type ObjContext struct {
 	Faces           []Face
 	TextureVertices []UV
 	VertexNormals   []Vec4
-	Textures        map[string]*Texture
+	Materials       map[string]*Material
 
 	VertexIndexOffset   int
 	TextureVertexOffset int
@@ -54,7 +55,7 @@ func parseTextureVertex(line string) (UV, error) {
 func parseVertexNormal(line string) (Vec4, error) {
 	var x, y, z float32
 	_, err := fmt.Sscanf(line, "vn %f %f %f", &x, &y, &z)
-	return Vec4{x, y, z, 1}, err
+	return Vec4{x, y, z, 0}, err
 }
 
 func parseFace(c *ObjContext, line string) (Face, error) {
@@ -181,6 +182,11 @@ func parseMtlLibFile(filename string) ([]ObjMaterial, error) {
 		case strings.HasPrefix(line, "map_Kd "):
 			mapKd := strings.TrimPrefix(line, "map_Kd ")
 			mat.MapKd = mapKd
+		case strings.HasPrefix(line, "map_Bump "), strings.HasPrefix(line, "map_bump "),
+			strings.HasPrefix(line, "bump "), strings.HasPrefix(line, "norm "):
+			// Options such as -bm may go before the file name, which is always the last
+			fields := strings.Fields(line)
+			mat.MapBump = fields[len(fields)-1]
 		}
 	}
 
@@ -206,11 +212,32 @@ func LoadObjFile(filename string, singleMesh bool) (meshes []*Mesh, _ error) {
 	dirname := path.Dir(filename)
 	scanner := bufio.NewScanner(file)
 	defaultTexture := &Texture{color: color.RGBA{255, 0, 255, 255}}
-	var currentTexture *Texture
+	var currentMaterial *Material
 
-	c := &ObjContext{Textures: make(map[string]*Texture)}
+	c := &ObjContext{Materials: make(map[string]*Material)}
 	textureFiles := make(map[string]*Texture)
 
+	loadTexture := func(filename string) (*Texture, error) {
+		if texture, ok := textureFiles[filename]; ok {
+			return texture, nil
+		}
+
+		log.Printf("[INFO] loading texture: %s", filename)
+
+		texturePath := filename
+		if texturePath[0] != '/' {
+			texturePath = path.Join(dirname, filename)
+		}
+
+		texture, err := LoadTextureFile(texturePath)
+		if err != nil {
+			return nil, err
+		}
+
+		textureFiles[filename] = texture
+		return texture, nil
+	}
+
 	for scanner.Scan() {
 		line := scanner.Text()
 		line = strings.TrimSpace(line)
@@ -229,29 +256,25 @@ func LoadObjFile(filename string, singleMesh bool) (meshes []*Mesh, _ error) {
 			}
 
 			for _, m := range materials {
+				material := NewMaterial(m.Name, defaultTexture)
+
 				if m.MapKd == "" {
 					log.Printf("[INFO] using default texture for material: %s", m.Name)
-					c.Textures[m.Name] = defaultTexture
 				} else {
-					if texture, ok := textureFiles[m.MapKd]; ok {
-						c.Textures[m.Name] = texture
-					} else {
-						log.Printf("[INFO] loading texture: %s", m.MapKd)
-
-						texturePath := m.MapKd
-						if texturePath[0] != '/' {
-							texturePath = path.Join(dirname, m.MapKd)
-						}
-
-						texture, err = LoadTextureFile(texturePath)
-						if err != nil {
-							return nil, fmt.Errorf("failed to load texture: %s", err)
-						}
-
-						textureFiles[m.MapKd] = texture
-						c.Textures[m.Name] = texture
+					material.Texture, err = loadTexture(m.MapKd)
+					if err != nil {
+						return nil, fmt.Errorf("failed to load texture: %s", err)
 					}
 				}
+
+				if m.MapBump != "" {
+					material.NormalMap, err = loadTexture(m.MapBump)
+					if err != nil {
+						return nil, fmt.Errorf("failed to load normal map: %s", err)
+					}
+				}
+
+				c.Materials[m.Name] = material
 			}
 
 		case strings.HasPrefix(line, "o "):
@@ -284,14 +307,14 @@ func LoadObjFile(filename string, singleMesh bool) (meshes []*Mesh, _ error) {
 
 		case strings.HasPrefix(line, "usemtl "):
 			mtlName := strings.TrimPrefix(line, "usemtl ")
-			currentTexture = c.Textures[mtlName]
+			currentMaterial = c.Materials[mtlName]
 
 		case strings.HasPrefix(line, "f "):
 			f, err := parseFace(c, line)
 			if err != nil {
 				return nil, err
 			}
-			f.Texture = currentTexture
+			f.Material = currentMaterial
 			c.Faces = append(c.Faces, f)
 		}
 	}
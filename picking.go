@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// PickResult describes the surface visible at a screen pixel.
+type PickResult struct {
+	Object   *Object
+	Face     int     // index in Object.Faces
+	Position Vec3    // world space
+	Depth    float32 // view space
+	Viewport int     // index of the viewport the pixel belongs to, see DrawViewports
+}
+
+// Pick returns the surface visible at the pixel of the last drawn frame, or false if
+// there is nothing there. Picking has to be enabled before the frame is drawn. Like the
+// G-buffer, the ID buffer is overwritten by the next frame, so it can only be read between frames.
+func (r *Renderer) Pick(x, y int) (PickResult, bool) {
+	if r.fb.ObjectIDs == nil || x < 0 || y < 0 || x >= r.fb.Width || y >= r.fb.Height {
+		return PickResult{}, false
+	}
+
+	index := y*r.fb.Width + x
+
+	id := r.fb.ObjectIDs[index]
+	if id == 0 || int(id) > len(r.pickObjects) {
+		return PickResult{}, false
+	}
+
+	// The last viewport drawn over the pixel is the visible one
+	for i := len(r.views) - 1; i >= 0; i-- {
+		view := &r.views[i]
+		if !image.Pt(x, y).In(view.scissor) {
+			continue
+		}
+
+		zRec := r.fb.ZBuffer[index]
+
+		return PickResult{
+			Object:   r.pickObjects[id-1],
+			Face:     int(r.fb.FaceIDs[index]),
+			Position: view.eye.Add(view.rays.Position(x, y, zRec)),
+			Depth:    view.rays.Depth(zRec),
+			Viewport: i,
+		}, true
+	}
+
+	return PickResult{}, false
+}
+
+// objectID returns the ID buffer value of the object in the current frame, or 0.
+func (r *Renderer) objectID(object *Object) uint32 {
+	if object == nil {
+		return 0
+	}
+
+	for i, obj := range r.pickObjects {
+		if obj == object {
+			return uint32(i + 1)
+		}
+	}
+
+	return 0
+}
+
+// HighlightEffect outlines the object with the given ID and tints it with the color.
+type HighlightEffect struct {
+	singlePass
+	Color    color.RGBA
+	ObjectID uint32
+}
+
+func (e *HighlightEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	const tint = 0.15
+
+	var (
+		c     = frame.DecodeColor(e.Color)
+		width = frame.Width
+		ids   = frame.ObjectIDs
+	)
+
+	// Pixels outside the viewport do not belong to the object
+	isObject := func(x, y int) bool {
+		return image.Pt(x, y).In(frame.Bounds) && ids[y*width+x] == e.ObjectID
+	}
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*width + x
+			frame.Dst[index] = frame.Src[index]
+
+			if !isObject(x, y) {
+				continue
+			}
+
+			if !isObject(x-1, y) || !isObject(x+1, y) || !isObject(x, y-1) || !isObject(x, y+1) {
+				frame.Dst[index] = c
+			} else {
+				frame.Dst[index] = lerpRGB(frame.Src[index], c, tint)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderer_Pick(t *testing.T) {
+	const width, height = 64, 48
+
+	var (
+		wall   = newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 4)
+		square = newQuadObject(Vec3{0, 0, -2}, Vec3{0, 0, 1}, 0.4)
+	)
+
+	scene := &Scene{
+		Objects: []*Object{wall, square},
+		Lights:  DefaultLights(),
+	}
+
+	renderer := newTestRenderer(width, height)
+	renderer.Picking = true
+	renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+	tests := map[string]struct {
+		x, y   int
+		object *Object
+		face   int
+		depth  float32
+	}{
+		"square in front":  {x: width / 2, y: height / 2, object: square, depth: 2},
+		"wall lower right": {x: width/2 + 8, y: height/2 + 6, object: wall, face: 0, depth: 5},
+		"wall upper left":  {x: width/2 - 8, y: height/2 - 6, object: wall, face: 1, depth: 5},
+		"background":       {x: 0, y: 0},
+		"outside frame":    {x: width, y: height / 2},
+		"negative":         {x: -1, y: height / 2},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := renderer.Pick(tt.x, tt.y)
+			if ok != (tt.object != nil) {
+				t.Fatalf("picked %t, want %t", ok, tt.object != nil)
+			}
+
+			if !ok {
+				return
+			}
+
+			if got.Object != tt.object {
+				t.Errorf("picked object %p, want %p", got.Object, tt.object)
+			}
+
+			if tt.object == wall && got.Face != tt.face {
+				t.Errorf("picked face %d, want %d", got.Face, tt.face)
+			}
+
+			if abs(got.Depth-tt.depth) > 1e-3 {
+				t.Errorf("depth is %g, want %g", got.Depth, tt.depth)
+			}
+
+			if abs(got.Position.Z+tt.depth) > 1e-3 {
+				t.Errorf("position is %v, want it at the depth %g", got.Position, tt.depth)
+			}
+		})
+	}
+}
+
+func TestRenderer_Pick_Disabled(t *testing.T) {
+	scene := &Scene{Objects: []*Object{newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 100)}}
+
+	renderer := newTestRenderer(64, 48)
+	renderer.Draw(scene, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+	if _, ok := renderer.Pick(32, 24); ok {
+		t.Error("picked without the ID buffer")
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// PostEffect is a full screen effect applied to the rasterized frame. Effects are chained:
+// each one reads the colors written by the previous one.
+type PostEffect interface {
+	// Passes returns the number of passes the effect needs. All tiles finish a pass before
+	// the next one starts, so a pass can read anything the previous pass wrote.
+	Passes() int
+
+	// Setup is called once per frame before the first pass, outside the tile workers.
+	Setup(frame *PostFrame)
+
+	// Apply runs the pass for the region of the frame. Every pixel of the region
+	// must be written to frame.Dst by the last pass.
+	Apply(frame *PostFrame, pass int, x0, y0, x1, y1 int)
+}
+
+// singlePass implements the optional parts of PostEffect for effects that only need one pass.
+type singlePass struct{}
+
+func (singlePass) Passes() int {
+	return 1
+}
+
+func (singlePass) Setup(*PostFrame) {}
+
+// PostFrame is the input and output of a post effect. Colors are in the shading color
+// space, linear if gamma correction is enabled, and in the 0..1 range. The buffers cover
+// the whole frame, but only the Bounds of the viewport being processed are valid.
+type PostFrame struct {
+	Width  int
+	Height int
+	Bounds image.Rectangle
+	Src    []RGB     // colors before the effect
+	Dst    []RGB     // colors after the effect
+	Depth  []float32 // depth buffer, greater values are closer, 0 for the background
+
+	// ObjectIDs is the object ID buffer of the frame buffer, nil unless picking is enabled.
+	ObjectIDs []uint32
+
+	renderer *Renderer
+}
+
+// At returns the source color, clamping the coordinates to the viewport edges.
+func (f *PostFrame) At(x, y int) RGB {
+	x = min(max(x, f.Bounds.Min.X), f.Bounds.Max.X-1)
+	y = min(max(y, f.Bounds.Min.Y), f.Bounds.Max.Y-1)
+	return f.Src[y*f.Width+x]
+}
+
+// Center returns the center of the viewport.
+func (f *PostFrame) Center() (x, y float32) {
+	return float32(f.Bounds.Min.X+f.Bounds.Max.X) / 2, float32(f.Bounds.Min.Y+f.Bounds.Max.Y) / 2
+}
+
+// IsBackground tells if there is no geometry at the pixel.
+func (f *PostFrame) IsBackground(x, y int) bool {
+	return f.Depth[y*f.Width+x] <= 0
+}
+
+// Distance returns the world space distance from the camera to the pixel,
+// or +Inf for the background.
+func (f *PostFrame) Distance(x, y int) float32 {
+	zRec := f.Depth[y*f.Width+x]
+	if zRec <= 0 {
+		return float32(math.Inf(1))
+	}
+
+	return f.renderer.rays.Distance(x, y, zRec)
+}
+
+// Position returns the world space position of the pixel relative to the camera.
+// The second value is false for the background.
+func (f *PostFrame) Position(x, y int) (Vec3, bool) {
+	return f.renderer.positionAt(x, y)
+}
+
+// Normal returns the world space surface normal of the pixel. The normals come from
+// the G-buffer in deferred mode, otherwise they are reconstructed from the depth.
+func (f *PostFrame) Normal(x, y int) Vec3 {
+	r := f.renderer
+	if r.geometryPass {
+		return r.gbuffer.Normals[y*f.Width+x]
+	}
+
+	p, ok := r.positionAt(x, y)
+	if !ok {
+		return Vec3{}
+	}
+
+	return r.normalFromDepth(x, y, p)
+}
+
+// DecodeColor converts the display color to the color space of the frame.
+func (f *PostFrame) DecodeColor(c color.RGBA) RGB {
+	return f.renderer.fb.decodeColor(c)
+}
+
+// EncodeColor converts the frame color to the display color.
+func (f *PostFrame) EncodeColor(c RGB) color.RGBA {
+	return f.renderer.fb.encodeColor(c)
+}
+
+// copyRegion copies the region from Src to Dst, for effects that only change a few pixels.
+func (f *PostFrame) copyRegion(x0, y0, x1, y1 int) {
+	for y := y0; y < y1; y++ {
+		copy(f.Dst[y*f.Width+x0:y*f.Width+x1], f.Src[y*f.Width+x0:y*f.Width+x1])
+	}
+}
+
+// FogEffect blends the geometry with the fog color depending on its distance from the camera.
+type FogEffect struct {
+	singlePass
+	Fog Fog
+}
+
+func (e *FogEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	fogColor := frame.DecodeColor(e.Fog.Color)
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			index := y*frame.Width + x
+			c := frame.Src[index]
+
+			if !frame.IsBackground(x, y) {
+				if amount := e.Fog.Amount(frame.Distance(x, y)); amount > 0 {
+					c = lerpRGB(c, fogColor, amount)
+				}
+			}
+
+			frame.Dst[index] = c
+		}
+	}
+}
+
+// CrossHairEffect draws a cross in the center of the viewport.
+type CrossHairEffect struct {
+	singlePass
+	Color color.RGBA
+}
+
+func (e *CrossHairEffect) Apply(frame *PostFrame, _ int, x0, y0, x1, y1 int) {
+	const size, offset = 5, 3
+
+	frame.copyRegion(x0, y0, x1, y1)
+
+	var (
+		c      = frame.DecodeColor(e.Color)
+		cx, cy = (frame.Bounds.Min.X + frame.Bounds.Max.X) / 2, (frame.Bounds.Min.Y + frame.Bounds.Max.Y) / 2
+	)
+
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			dx, dy := abs(x-cx), abs(y-cy)
+
+			if (dy == 0 && dx >= offset && dx <= size) || (dx == 0 && dy >= offset && dy <= size) {
+				frame.Dst[y*frame.Width+x] = c
+			}
+		}
+	}
+}
+
+// loadPostFrame decodes the tile pixels into the post-processing buffer.
+func (r *Renderer) loadPostFrame(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+			r.postFrame.Src[index] = r.fb.decodeColor(r.fb.Pixels[index])
+		}
+	}
+}
+
+// storePostFrame encodes the tile of the post-processed frame back to the pixels.
+func (r *Renderer) storePostFrame(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+			r.fb.Pixels[index] = r.fb.encodeColor(r.postFrame.Src[index])
+		}
+	}
+}
+
+// postProcess runs the effects one after another over all tiles. The frame buffers
+// are swapped after each effect, so that the next effect reads its output.
+func (r *Renderer) postProcess(effects []PostEffect) {
+	if len(effects) == 0 {
+		return
+	}
+
+	size := r.fb.Width * r.fb.Height
+	if len(r.postFrame.Src) != size {
+		r.postFrame.Src = make([]RGB, size)
+		r.postFrame.Dst = make([]RGB, size)
+	}
+
+	r.postFrame.Width = r.fb.Width
+	r.postFrame.Height = r.fb.Height
+	r.postFrame.Bounds = r.scissor
+	r.postFrame.Depth = r.fb.ZBuffer
+	r.postFrame.ObjectIDs = r.fb.ObjectIDs
+	r.postFrame.renderer = r
+
+	r.runTiles(r.loadPostFrame)
+
+	for _, effect := range effects {
+		effect.Setup(&r.postFrame)
+
+		for pass := range effect.Passes() {
+			r.runTiles(func(tile uint) {
+				start, end := r.tileBounds[tile][0], r.tileBounds[tile][1]
+				effect.Apply(&r.postFrame, pass, int(start.X), int(start.Y), int(end.X), int(end.Y))
+			})
+		}
+
+		r.postFrame.Src, r.postFrame.Dst = r.postFrame.Dst, r.postFrame.Src
+	}
+
+	r.runTiles(r.storePostFrame)
+}
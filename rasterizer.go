@@ -1,6 +1,7 @@
 package main
 
 import (
+	"image"
 	"image/color"
 )
 
@@ -10,6 +11,34 @@ type FrameBuffer struct {
 	ZBuffer []float32
 	Pixels  []color.RGBA
 	Pixels2 []color.RGBA
+
+	// Colors is the linear HDR color buffer. When enabled, shading results are written
+	// here without clamping and resolved to Pixels through tone mapping.
+	Colors []RGB
+
+	// Linear enables gamma-correct shading: colors are decoded from sRGB before lighting
+	// and blending, and encoded back to sRGB when written to Pixels.
+	Linear bool
+
+	// ObjectIDs and FaceIDs identify the triangle visible in each pixel, used for picking.
+	// Object IDs start from 1, with 0 meaning no object. Both are nil unless enabled.
+	ObjectIDs []uint32
+	FaceIDs   []uint32
+
+	// scissor limits the points and lines to the viewport being drawn.
+	scissor image.Rectangle
+
+	// logDepthFar and logDepthScale give the logarithmic depth of the pixels, see DepthLogarithmic.
+	// The scale is 0 in the other modes, where the vertex depth is interpolated.
+	logDepthFar   float32
+	logDepthScale float32
+}
+
+// ShadingContext holds the per-frame state shared by all triangles during rasterization.
+type ShadingContext struct {
+	Eye         Vec3         // camera position in world space
+	Environment *Environment // reflected by the materials, optional
+	GBuffer     *GBuffer     // receives the albedo and the material of the shaded pixels, optional
 }
 
 func NewFrameBuffer(width, height int) *FrameBuffer {
@@ -19,13 +48,108 @@ func NewFrameBuffer(width, height int) *FrameBuffer {
 		Pixels:  make([]color.RGBA, width*height),
 		Pixels2: make([]color.RGBA, width*height),
 		ZBuffer: make([]float32, width*height),
+		scissor: image.Rect(0, 0, width, height),
+	}
+}
+
+// NewDepthBuffer creates a frame buffer without color data, suitable for DepthTriangle only.
+func NewDepthBuffer(width, height int) *FrameBuffer {
+	return &FrameBuffer{
+		Width:   width,
+		Height:  height,
+		ZBuffer: make([]float32, width*height),
+		scissor: image.Rect(0, 0, width, height),
 	}
 }
 
+// Resize reallocates the buffers for the new size. The contents are lost, and the optional
+// buffers stay enabled. It must not be called while a frame is being drawn.
+func (fb *FrameBuffer) Resize(width, height int) {
+	if width == fb.Width && height == fb.Height {
+		return
+	}
+
+	size := width * height
+	fb.Width, fb.Height = width, height
+	fb.Pixels = resized(fb.Pixels, size)
+	fb.Pixels2 = resized(fb.Pixels2, size)
+	fb.ZBuffer = resized(fb.ZBuffer, size)
+	fb.Colors = resized(fb.Colors, size)
+	fb.ObjectIDs = resized(fb.ObjectIDs, size)
+	fb.FaceIDs = resized(fb.FaceIDs, size)
+	fb.scissor = image.Rect(0, 0, width, height)
+}
+
+// resized returns a new buffer of the given size, or nil if the buffer is not allocated.
+func resized[T any](buf []T, size int) []T {
+	if buf == nil {
+		return nil
+	}
+
+	return make([]T, size)
+}
+
 func (fb *FrameBuffer) Pixel(x, y int, c color.RGBA) {
-	idx := y*fb.Width + x
-	if idx > 0 && idx < len(fb.Pixels) {
+	// Points can be outside the screen within the clipping guard band
+	if image.Pt(x, y).In(fb.scissor) {
+		idx := y*fb.Width + x
 		fb.Pixels[idx] = c
+
+		if fb.Colors != nil {
+			fb.Colors[idx] = fb.decodeColor(c)
+		}
+	}
+}
+
+// decodeColor converts the display color to the color space used for shading.
+func (fb *FrameBuffer) decodeColor(c color.RGBA) RGB {
+	if fb.Linear {
+		return linearFromSRGB(c)
+	}
+
+	return RGBFromColor(c)
+}
+
+// encodeColor converts the shaded color back to the display color.
+func (fb *FrameBuffer) encodeColor(c RGB) color.RGBA {
+	if fb.Linear {
+		return srgbFromLinear(c)
+	}
+
+	return colorFromRGB(c)
+}
+
+// EnableHDR allocates or releases the HDR color buffer.
+func (fb *FrameBuffer) EnableHDR(enabled bool) {
+	switch {
+	case enabled && fb.Colors == nil:
+		fb.Colors = make([]RGB, fb.Width*fb.Height)
+	case !enabled:
+		fb.Colors = nil
+	}
+}
+
+// ResolveHDR tone maps the region of the HDR buffer into Pixels. It must be called
+// before SwapBuffers, so that the front buffer always holds the tone mapped frame.
+func (fb *FrameBuffer) ResolveHDR(toneMapping ToneMapping, exposure float32, startX, startY, endX, endY int) {
+	for y := startY; y < endY; y++ {
+		for x := startX; x < endX; x++ {
+			index := y*fb.Width + x
+			c := toneMapping.Apply(fb.Colors[index].Multiply(exposure))
+			fb.Pixels[index] = fb.encodeColor(c)
+		}
+	}
+}
+
+// EnableIDBuffer allocates or releases the object and face ID buffers.
+func (fb *FrameBuffer) EnableIDBuffer(enabled bool) {
+	switch {
+	case enabled && fb.ObjectIDs == nil:
+		fb.ObjectIDs = make([]uint32, fb.Width*fb.Height)
+		fb.FaceIDs = make([]uint32, fb.Width*fb.Height)
+	case !enabled:
+		fb.ObjectIDs = nil
+		fb.FaceIDs = nil
 	}
 }
 
@@ -34,23 +158,60 @@ func (fb *FrameBuffer) SwapBuffers() {
 }
 
 func (fb *FrameBuffer) Clear(c color.RGBA) {
-	fb.ZBuffer[0] = -1.0
+	fb.ZBuffer[0] = 0 // the far plane, see DepthMode
 	fb.Pixels[0] = c
 
 	for i := 1; i < len(fb.Pixels); i *= 2 {
 		copy(fb.Pixels[i:], fb.Pixels[:i])
 		copy(fb.ZBuffer[i:], fb.ZBuffer[:i])
 	}
+
+	if fb.Colors != nil {
+		fb.Colors[0] = fb.decodeColor(c)
+
+		for i := 1; i < len(fb.Colors); i *= 2 {
+			copy(fb.Colors[i:], fb.Colors[:i])
+		}
+	}
+
+	// Face IDs are only meaningful where there is an object
+	clear(fb.ObjectIDs)
 }
 
-func (fb *FrameBuffer) DotGrid(c color.RGBA, step int) {
-	for y := step; y < fb.Height; y += step {
-		for x := step; x < fb.Width; x += step {
-			fb.Pixel(x, y, c)
+// ClearRect clears the region of the frame buffer, like Clear.
+func (fb *FrameBuffer) ClearRect(c color.RGBA, startX, startY, endX, endY int) {
+	for y := startY; y < endY; y++ {
+		var (
+			start = y*fb.Width + startX
+			end   = y*fb.Width + endX
+		)
+
+		for i := start; i < end; i++ {
+			fb.Pixels[i] = c
+			fb.ZBuffer[i] = 0
+		}
+
+		if fb.Colors != nil {
+			linear := fb.decodeColor(c)
+			for i := start; i < end; i++ {
+				fb.Colors[i] = linear
+			}
+		}
+
+		if fb.ObjectIDs != nil {
+			clear(fb.ObjectIDs[start:end])
 		}
 	}
 }
 
+func (fb *FrameBuffer) ClearDepth(depth float32) {
+	fb.ZBuffer[0] = depth
+
+	for i := 1; i < len(fb.ZBuffer); i *= 2 {
+		copy(fb.ZBuffer[i:], fb.ZBuffer[:i])
+	}
+}
+
 func (fb *FrameBuffer) Rect(x, y, width, height int, c color.RGBA) {
 	if x >= fb.Width || y >= fb.Height {
 		return
@@ -78,30 +239,22 @@ func (fb *FrameBuffer) Line(x0, y0 int, x1, y1 int, c color.RGBA) {
 	}
 }
 
-func colorIntensity(c color.RGBA, intensity float32) color.RGBA {
-	return color.RGBA{
-		R: uint8(float32(c.R) * intensity),
-		G: uint8(float32(c.G) * intensity),
-		B: uint8(float32(c.B) * intensity),
-		A: c.A,
-	}
-}
-
-func (fb *FrameBuffer) Triangle(
-	x0, y0 int, z0 float32, u0, v0 float32,
-	x1, y1 int, z1 float32, u1, v1 float32,
-	x2, y2 int, z2 float32, u2, v2 float32,
+// rasterizeTriangle calls fragment for each pixel of the tile covered by the triangle, with
+// the pixel index and the screen space barycentric coordinates. The edge functions must be
+// negative inside, and the pixels on the edges follow the top-left rule unless inclusive is set.
+func (fb *FrameBuffer) rasterizeTriangle(
+	x0, y0, x1, y1, x2, y2 int,
 	tileStartX, tileStartY, tileEndX, tileEndY int,
-	intensA, intensB, intensC float32,
-	texture *Texture,
+	inclusive bool,
+	fragment func(index int, alpha, beta, gamma float32),
 ) {
 	// Find the bounding box of the triangle
 	minX, maxX := min(x0, x1, x2), max(x0, x1, x2)
 	minY, maxY := min(y0, y1, y2), max(y0, y1, y2)
 
-	// Clip the bounding box to the tile boundaries
-	minX, maxX = max(minX, tileStartX, 0), min(maxX, tileEndX, fb.Width-1)
-	minY, maxY = max(minY, tileStartY, 0), min(maxY, tileEndY, fb.Height-1)
+	// Clip the bounding box to the tile boundaries (tile end is exclusive)
+	minX, maxX = max(minX, tileStartX, 0), min(maxX, tileEndX-1, fb.Width-1)
+	minY, maxY = max(minY, tileStartY, 0), min(maxY, tileEndY-1, fb.Height-1)
 
 	// Calculate initial edge function values for the first pixel in the bounding box
 	f01 := (y0-y1)*minX + (x1-x0)*minY + (x0*y1 - x1*y0)
@@ -109,16 +262,13 @@ func (fb *FrameBuffer) Triangle(
 	f20 := (y2-y0)*minX + (x0-x2)*minY + (x2*y0 - x0*y2)
 
 	// Calculate the change in the edge function values when moving one pixel to the right and down
-	f01dx := y0 - y1
-	f01dy := x1 - x0
-	f12dx := y1 - y2
-	f12dy := x2 - x1
-	f20dx := y2 - y0
-	f20dy := x0 - x2
+	f01dx, f01dy := y0-y1, x1-x0
+	f12dx, f12dy := y1-y2, x2-x1
+	f20dx, f20dy := y2-y0, x0-x2
 
 	// Top-left rule adjustment for the edge functions
 	edgeAdjust := func(f, dx, dy int) int {
-		if dy > 0 || (dy == 0 && dx > 0) {
+		if !inclusive && (dy > 0 || (dy == 0 && dx > 0)) {
 			return f
 		}
 		return f - 1
@@ -128,14 +278,6 @@ func (fb *FrameBuffer) Triangle(
 	f12 = edgeAdjust(f12, f12dx, f12dy)
 	f20 = edgeAdjust(f20, f20dx, f20dy)
 
-	// Precalculate factors for uv interpolation
-	v0z0 := v0 / z0
-	u0z0 := u0 / z0
-	u1z1 := u1 / z1
-	v1z1 := v1 / z1
-	u2z2 := u2 / z2
-	v2z2 := v2 / z2
-
 	// Iterate through the bounding box
 	for y := minY; y <= maxY; y++ {
 		fx01 := f01
@@ -145,30 +287,10 @@ func (fb *FrameBuffer) Triangle(
 		for x := minX; x <= maxX; x++ {
 			// Check if the point is inside the triangle using the edge function values
 			if fx01 < 0 && fx12 < 0 && fx20 < 0 {
-				// Compute barycentric coordinates for x, y
-				alpha := float32(fx12) / float32(fx12+fx20+fx01)
-				beta := float32(fx20) / float32(fx12+fx20+fx01)
-				gamma := 1 - alpha - beta
-
-				zRec := -(alpha/z0 + beta/z1 + gamma/z2)
-				index := y*fb.Width + x
-
-				if zRec >= fb.ZBuffer[index] {
-					// Interpolate texture coordinates
-					u := (alpha*u0z0 + beta*u1z1 + gamma*u2z2) / zRec
-					v := (alpha*v0z0 + beta*v1z1 + gamma*v2z2) / zRec
-
-					// Interpolate light intensity
-					intensity := alpha*intensA + beta*intensB + gamma*intensC
-
-					c := faceColor
-					if texture != nil {
-						c = texture.Sample(u, v)
-					}
-
-					fb.ZBuffer[index] = zRec
-					fb.Pixels[index] = colorIntensity(c, intensity)
-				}
+				sum := float32(fx12 + fx20 + fx01)
+				alpha := float32(fx12) / sum
+				beta := float32(fx20) / sum
+				fragment(y*fb.Width+x, alpha, beta, 1-alpha-beta)
 			}
 
 			fx01 += f01dx
@@ -182,36 +304,234 @@ func (fb *FrameBuffer) Triangle(
 	}
 }
 
-func blendRGBA(a, b color.RGBA, f float32) color.RGBA {
-	cr := uint8(float32(a.R)*(1-f) + float32(b.R)*f)
-	cg := uint8(float32(a.G)*(1-f) + float32(b.G)*f)
-	cb := uint8(float32(a.B)*(1-f) + float32(b.B)*f)
-	ca := uint8(float32(a.A)*(1-f) + float32(b.A)*f)
-	return color.RGBA{cr, cg, cb, ca}
+// Triangle rasterizes the part of the triangle that falls into the given tile. Triangle’s
+// PixelLights are evaluated for every pixel, on top of the light interpolated between vertices.
+// Reflective triangles are blended with the environment from the shading context.
+// Returns the number of fragments that passed the depth test.
+func (fb *FrameBuffer) Triangle(t *Triangle, ctx *ShadingContext, tileStartX, tileStartY, tileEndX, tileEndY int) (fragments int) {
+	va, vb, vc := &t.Vertices[0], &t.Vertices[1], &t.Vertices[2]
+	reflective := t.Reflectivity > 0 && ctx.Environment != nil
+
+	// Precalculate reciprocal W for perspective-correct interpolation
+	rw0 := 1 / va.Position.W
+	rw1 := 1 / vb.Position.W
+	rw2 := 1 / vc.Position.W
+
+	fb.rasterizeTriangle(
+		int(va.Position.X), int(va.Position.Y),
+		int(vb.Position.X), int(vb.Position.Y),
+		int(vc.Position.X), int(vc.Position.Y),
+		tileStartX, tileStartY, tileEndX, tileEndY, false,
+		func(index int, alpha, beta, gamma float32) {
+			wRec := alpha*rw0 + beta*rw1 + gamma*rw2
+			zRec := fb.fragmentDepth(t, alpha, beta, gamma, wRec)
+
+			if zRec < fb.ZBuffer[index] {
+				return
+			}
+
+			// Perspective-correct barycentric coordinates
+			pa := alpha * rw0 / wRec
+			pb := beta * rw1 / wRec
+			pc := 1 - pa - pb
+
+			// Interpolate texture coordinates
+			u := pa*va.UV.U + pb*vb.UV.U + pc*vc.UV.U
+			v := pa*va.UV.V + pb*vb.UV.V + pc*vc.UV.V
+
+			// Interpolate light color
+			light := RGB{
+				R: alpha*va.Light.R + beta*vb.Light.R + gamma*vc.Light.R,
+				G: alpha*va.Light.G + beta*vb.Light.G + gamma*vc.Light.G,
+				B: alpha*va.Light.B + beta*vb.Light.B + gamma*vc.Light.B,
+			}
+
+			var reflection color.RGBA
+
+			if len(t.PixelLights) != 0 || reflective {
+				world := va.World.Multiply(pa).Add(vb.World.Multiply(pb)).Add(vc.World.Multiply(pc))
+				normal := t.interpolateNormal(pa, pb, pc, u, v)
+
+				for i := range t.PixelLights {
+					light = light.Add(t.PixelLights[i].IlluminateShadowed(world, normal))
+				}
+
+				if reflective {
+					reflection = ctx.Environment.Sample(reflect(world.Sub(ctx.Eye), normal))
+				}
+			}
+
+			if t.LightBands > 0 {
+				light = light.Quantize(t.LightBands)
+			}
+
+			c := faceColor
+			if t.Texture != nil {
+				c = t.Texture.Sample(u, v)
+			}
+
+			fb.ZBuffer[index] = zRec
+			fragments++
+
+			if fb.ObjectIDs != nil {
+				fb.ObjectIDs[index] = t.ObjectID
+				fb.FaceIDs[index] = t.FaceID
+			}
+
+			if ctx.GBuffer != nil {
+				ctx.GBuffer.Albedo[index] = c
+				ctx.GBuffer.MaterialIDs[index] = t.MaterialID
+			}
+
+			if fb.Colors != nil || fb.Linear {
+				// Shade in floating point for tone mapping or sRGB encoding
+				hdr := fb.decodeColor(c).Modulate(light)
+				if reflective {
+					hdr = lerpRGB(hdr, fb.decodeColor(reflection), t.Reflectivity)
+				}
+
+				if fb.Colors != nil {
+					fb.Colors[index] = hdr
+				} else {
+					fb.Pixels[index] = fb.encodeColor(hdr)
+				}
+			} else {
+				c = colorLight(c, light)
+				if reflective {
+					c = blendRGBA(c, reflection, t.Reflectivity)
+				}
+
+				fb.Pixels[index] = c
+			}
+		},
+	)
+
+	return fragments
 }
 
-func (fb *FrameBuffer) Fog(fogStart, fogEnd float32, c color.RGBA) {
-	for i := range fb.Pixels {
-		depth := fb.ZBuffer[i]
+// GeometryTriangle rasterizes the part of the triangle that falls into the given tile into
+// the G-buffer, without any lighting. The lighting is computed later, once per pixel.
+// Returns the number of fragments that passed the depth test.
+func (fb *FrameBuffer) GeometryTriangle(t *Triangle, g *GBuffer, tileStartX, tileStartY, tileEndX, tileEndY int) (fragments int) {
+	va, vb, vc := &t.Vertices[0], &t.Vertices[1], &t.Vertices[2]
+
+	rw0 := 1 / va.Position.W
+	rw1 := 1 / vb.Position.W
+	rw2 := 1 / vc.Position.W
+
+	fb.rasterizeTriangle(
+		int(va.Position.X), int(va.Position.Y),
+		int(vb.Position.X), int(vb.Position.Y),
+		int(vc.Position.X), int(vc.Position.Y),
+		tileStartX, tileStartY, tileEndX, tileEndY, false,
+		func(index int, alpha, beta, gamma float32) {
+			wRec := alpha*rw0 + beta*rw1 + gamma*rw2
+			zRec := fb.fragmentDepth(t, alpha, beta, gamma, wRec)
+
+			if zRec < fb.ZBuffer[index] {
+				return
+			}
 
-		switch {
-		case depth >= fogStart:
-			// noop
-		case depth <= fogEnd:
-			fb.Pixels[i] = c
-		default:
-			f := 1 - ((fogEnd - depth) / (fogEnd - fogStart))
-			fb.Pixels[i] = blendRGBA(fb.Pixels[i], c, f)
-		}
+			pa := alpha * rw0 / wRec
+			pb := beta * rw1 / wRec
+			pc := 1 - pa - pb
+
+			u := pa*va.UV.U + pb*vb.UV.U + pc*vc.UV.U
+			v := pa*va.UV.V + pb*vb.UV.V + pc*vc.UV.V
+
+			c := faceColor
+			if t.Texture != nil {
+				c = t.Texture.Sample(u, v)
+			}
+
+			fb.ZBuffer[index] = zRec
+			fragments++
+
+			if fb.ObjectIDs != nil {
+				fb.ObjectIDs[index] = t.ObjectID
+				fb.FaceIDs[index] = t.FaceID
+			}
+
+			g.Albedo[index] = c
+			g.Normals[index] = t.interpolateNormal(pa, pb, pc, u, v)
+			g.MaterialIDs[index] = t.MaterialID
+
+			if g.UVs != nil {
+				g.UVs[index] = UV{u, v}
+				g.Overdraw[index]++
+			}
+		},
+	)
+
+	return fragments
+}
+
+// fragmentDepth returns the depth buffer value of the pixel at the screen space barycentric
+// coordinates, given the interpolated reciprocal of W, see DepthMode.
+func (fb *FrameBuffer) fragmentDepth(t *Triangle, alpha, beta, gamma, wRec float32) float32 {
+	if fb.logDepthScale != 0 {
+		return log32(fb.logDepthFar*wRec)*fb.logDepthScale + t.DepthBias
 	}
+
+	va, vb, vc := &t.Vertices[0], &t.Vertices[1], &t.Vertices[2]
+	return alpha*va.Position.Z + beta*vb.Position.Z + gamma*vc.Position.Z + t.DepthBias
 }
 
-func (fb *FrameBuffer) CrossHair(c color.RGBA) {
-	const size, offset = 5, 3
-	x, y := fb.Width/2, fb.Height/2
+// interpolateNormal returns the surface normal at the perspective-correct barycentric
+// coordinates, perturbed by the normal map at the given texture coordinates.
+func (t *Triangle) interpolateNormal(pa, pb, pc, u, v float32) Vec3 {
+	va, vb, vc := &t.Vertices[0], &t.Vertices[1], &t.Vertices[2]
+	normal := va.Normal.Multiply(pa).Add(vb.Normal.Multiply(pb)).Add(vc.Normal.Multiply(pc))
+
+	if t.NormalMap != nil {
+		// Tangent space normal is stored as 0..255 color values for -1..1 range
+		texel := t.NormalMap.Sample(u, v)
+		nx := float32(texel.R)/127.5 - 1
+		ny := float32(texel.G)/127.5 - 1
+		nz := float32(texel.B)/127.5 - 1
+
+		tangent := va.Tangent.Multiply(pa).Add(vb.Tangent.Multiply(pb)).Add(vc.Tangent.Multiply(pc))
+		bitangent := va.Bitangent.Multiply(pa).Add(vb.Bitangent.Multiply(pb)).Add(vc.Bitangent.Multiply(pc))
+		normal = tangent.Multiply(nx).Add(bitangent.Multiply(ny)).Add(normal.Normalize().Multiply(nz))
+	}
 
-	fb.Line(x-size, y, x-offset, y, c)
-	fb.Line(x+offset, y, x+size, y, c)
-	fb.Line(x, y-size, x, y-offset, c)
-	fb.Line(x, y+offset, x, y+size, c)
+	return normal.Normalize()
+}
+
+// DepthTriangle rasterizes the triangle into the depth buffer only, keeping the smallest
+// depth value. Z coordinates are interpolated linearly in screen space. Unlike Triangle,
+// it accepts both clockwise and counter-clockwise triangles.
+func (fb *FrameBuffer) DepthTriangle(
+	x0, y0 int, z0 float32,
+	x1, y1 int, z1 float32,
+	x2, y2 int, z2 float32,
+	tileStartX, tileStartY, tileEndX, tileEndY int,
+) {
+	area := (x1-x0)*(y2-y0) - (x2-x0)*(y1-y0)
+	if area == 0 {
+		return
+	}
+
+	// The edge functions expect a negative area
+	if area > 0 {
+		x1, y1, z1, x2, y2, z2 = x2, y2, z2, x1, y1, z1
+	}
+
+	fb.rasterizeTriangle(
+		x0, y0, x1, y1, x2, y2,
+		tileStartX, tileStartY, tileEndX, tileEndY, true,
+		func(index int, alpha, beta, gamma float32) {
+			if z := alpha*z0 + beta*z1 + gamma*z2; z < fb.ZBuffer[index] {
+				fb.ZBuffer[index] = z
+			}
+		},
+	)
+}
+
+func blendRGBA(a, b color.RGBA, f float32) color.RGBA {
+	cr := uint8(float32(a.R)*(1-f) + float32(b.R)*f)
+	cg := uint8(float32(a.G)*(1-f) + float32(b.G)*f)
+	cb := uint8(float32(a.B)*(1-f) + float32(b.B)*f)
+	ca := uint8(float32(a.A)*(1-f) + float32(b.A)*f)
+	return color.RGBA{cr, cg, cb, ca}
 }
@@ -1,36 +1,61 @@
 package main
 
 import (
+	"fmt"
+	"image"
 	"image/color"
 	"math"
 	"runtime"
 	"sync"
+	"time"
 )
 
 const (
-	maxTiles        = 16
-	diffuseStrength = 0.5
-	ambientStrength = 0.5
+	maxTiles = 16
+
+	// guardBandSize is the size of the area triangles are clipped to, relative to the screen,
+	// see Frustum.SetGuardBand. Larger triangles lose the precision of the barycentric
+	// coordinates, computed in float32 from the integer edge functions.
+	guardBandSize = 2
 )
 
 var (
 	faceColor   = color.RGBA{200, 200, 200, 255}
 	vertexColor = color.RGBA{255, 161, 0, 255}
 	edgeColor   = color.RGBA{0, 0, 0, 255}
+
+	// The environment is drawn by the tile workers behind the geometry
+	backgroundColor = color.RGBA{50, 50, 50, 255}
+
+	// The dot grid is drawn over the background when there is no environment
+	dotGridColor = color.RGBA{100, 100, 100, 255}
+	dotGridStep  = 10
 )
 
-type Camera struct {
-	Position  Vec3
-	Direction Vec3
-	Up        Vec3
+// Vertex holds the attributes of a triangle vertex that are interpolated during clipping
+// and rasterization. World space position, normal and tangents are used for per-pixel lighting.
+type Vertex struct {
+	Position  Vec4
+	UV        UV
+	Light     RGB
+	World     Vec3
+	Normal    Vec3
+	Tangent   Vec3
+	Bitangent Vec3
 }
 
 // Triangle is a 2D projection of a Face.
 type Triangle struct {
-	Points    [3]Vec4
-	UVs       [3]UV
-	Intensity [3]float32
-	Texture   *Texture
+	Vertices     [3]Vertex
+	Texture      *Texture
+	NormalMap    *Texture
+	PixelLights  []Light // lights that are evaluated per pixel rather than per vertex
+	Reflectivity float32 // share of the reflected environment color, 0..1
+	MaterialID   uint16  // G-buffer material ID, used by deferred shading
+	LightBands   int     // quantize the light into bands per unit intensity, 0 to disable
+	ObjectID     uint32  // index of the object in the scene plus one, for picking
+	FaceID       uint32  // index of the face in the object mesh
+	DepthBias    float32 // added to the depth buffer value, see Object.DepthBias
 }
 
 type DebugInfo struct {
@@ -38,13 +63,18 @@ type DebugInfo struct {
 	Text string
 }
 
+// projectionTask projects the object either to the screen or to the shadow map, if set.
 type projectionTask struct {
-	object *Object
-	camera *Camera
+	object    *Object
+	objectID  uint32
+	camera    *Camera
+	shadowMap *ShadowMap
 }
 
-type rasterizationTask struct {
+// tileTask runs one of the per-tile passes of the frame.
+type tileTask struct {
 	tile uint
+	pass func(tile uint)
 }
 
 func calculateTileBoundaries(tile uint, numTiles uint, width, height int) (start, end Vec2) {
@@ -75,17 +105,158 @@ func calculateTileBoundaries(tile uint, numTiles uint, width, height int) (start
 	return start, end
 }
 
+// viewRays generates the world space directions through the pixel centers, scaled to
+// a unit length along the camera direction, so that the view depth gives the position.
+type viewRays struct {
+	forward, right, up Vec3
+	x0, y0             float32 // top-left corner of the viewport
+	width, height      float32
+	orthographic       bool
+	zNear, zFar        float32
+	depthMode          DepthMode
+	logScale           float32 // 1 / log(zFar / zNear), see DepthLogarithmic
+}
+
+func newViewRays(camera *Camera, depthMode DepthMode, viewport image.Rectangle) viewRays {
+	var (
+		aspect  = float32(viewport.Dx()) / float32(viewport.Dy())
+		forward = camera.Direction.Normalize()
+		right   = forward.CrossProduct(camera.Up).Normalize()
+		up      = right.CrossProduct(forward)
+	)
+
+	rays := viewRays{
+		forward:   forward,
+		x0:        float32(viewport.Min.X),
+		y0:        float32(viewport.Min.Y),
+		width:     float32(viewport.Dx()),
+		height:    float32(viewport.Dy()),
+		zNear:     camera.Near,
+		zFar:      camera.Far,
+		depthMode: depthMode,
+		logScale:  1 / log32(camera.Far/camera.Near),
+	}
+
+	if camera.Projection == ProjectionOrthographic {
+		// The view plane is the same size at any distance
+		rays.right = right.Multiply(camera.OrthoExtent * aspect)
+		rays.up = up.Multiply(camera.OrthoExtent)
+		rays.orthographic = true
+
+		// The depth is linear, see DepthLogarithmic
+		if depthMode == DepthLogarithmic {
+			rays.depthMode = DepthReversed
+		}
+	} else {
+		// Size of the view plane at unit distance from the camera
+		tanHalfFov := tan32(camera.FOV / 2)
+		rays.right = right.Multiply(tanHalfFov * aspect)
+		rays.up = up.Multiply(tanHalfFov)
+	}
+
+	return rays
+}
+
+// offset returns the point of the view plane the pixel center is on.
+func (v *viewRays) offset(x, y int) Vec3 {
+	ndcX := 2*(float32(x)-v.x0+0.5)/v.width - 1
+	ndcY := 1 - 2*(float32(y)-v.y0+0.5)/v.height
+	return v.right.Multiply(ndcX).Add(v.up.Multiply(ndcY))
+}
+
+// At returns the direction of the ray through the pixel.
+func (v *viewRays) At(x, y int) Vec3 {
+	if v.orthographic {
+		return v.forward
+	}
+
+	return v.forward.Add(v.offset(x, y))
+}
+
+// Project is the inverse of Position: it returns the pixel coordinates and the view depth
+// of the point, given relative to the camera position.
+func (v *viewRays) Project(point Vec3) (x, y, depth float32) {
+	depth = point.DotProduct(v.forward)
+
+	scale := depth
+	if v.orthographic {
+		scale = 1
+	}
+
+	ndcX := point.DotProduct(v.right) / (scale * v.right.DotProduct(v.right))
+	ndcY := point.DotProduct(v.up) / (scale * v.up.DotProduct(v.up))
+	x = v.x0 + (ndcX+1)*v.width/2 - 0.5
+	y = v.y0 + (1-ndcY)*v.height/2 - 0.5
+	return x, y, depth
+}
+
+// EncodeDepth returns the depth buffer value of the clip space point, see DepthMode.
+func (v *viewRays) EncodeDepth(p Vec4) float32 {
+	switch v.depthMode {
+	case DepthStandard:
+		return 1 - p.Z/p.W
+	case DepthLogarithmic:
+		return log32(v.zFar/p.W) * v.logScale
+	default:
+		return p.Z / p.W
+	}
+}
+
+// LinearDepth returns the depth buffer value as a value that is linear across flat surfaces.
+func (v *viewRays) LinearDepth(zRec float32) float32 {
+	if v.orthographic || zRec <= 0 {
+		return zRec
+	}
+
+	return 1 / v.Depth(zRec)
+}
+
+// Depth returns the view depth of the depth buffer value.
+func (v *viewRays) Depth(zRec float32) float32 {
+	switch {
+	case v.orthographic:
+		return v.zFar - zRec*(v.zFar-v.zNear)
+	case v.depthMode == DepthLogarithmic:
+		return v.zFar * exp32(-zRec/v.logScale)
+	default:
+		return v.zNear * v.zFar / (zRec*(v.zFar-v.zNear) + v.zNear)
+	}
+}
+
+// Position returns the point of the pixel at the depth buffer value, relative to the camera.
+func (v *viewRays) Position(x, y int, zRec float32) Vec3 {
+	depth := v.Depth(zRec)
+
+	if v.orthographic {
+		return v.offset(x, y).Add(v.forward.Multiply(depth))
+	}
+
+	return v.At(x, y).Multiply(depth)
+}
+
+// Distance returns the distance to the pixel at the depth buffer value. In the
+// orthographic projection it is the distance from the view plane.
+func (v *viewRays) Distance(x, y int, zRec float32) float32 {
+	if v.orthographic {
+		return v.Depth(zRec)
+	}
+
+	return v.At(x, y).Length() * v.Depth(zRec)
+}
+
 type LocalBuffer struct {
 	tileTriangles     [maxTiles][128]Triangle
 	tileTriangleCount [maxTiles]int
+
+	shadowTriangles     [maxTiles][128][3]Vec4
+	shadowTriangleCount [maxTiles]int
 }
 
 type Renderer struct {
-	fb               *FrameBuffer
-	frustum          *Frustum
-	aspectX, aspectY float32
-	zNear, zFar      float32
-	fovX, fovY       float32
+	fb         *FrameBuffer
+	frustum    *Frustum
+	projection Matrix // camera projection of the current viewport
+	screen     Matrix // maps the projection onto the current viewport
 
 	FrustumClipping bool
 	ShowVertices    bool
@@ -95,31 +266,102 @@ type Renderer struct {
 	Lighting        bool
 	FlatShading     bool
 	ShowTextures    bool
+	Shadows         bool
 	TPF             int // Triangles per frame
 
+	// HDR enables the floating point color buffer, resolved with ToneMapping.
+	HDR         bool
+	ToneMapping ToneMapping
+	Exposure    float32
+
+	// GammaCorrection enables lighting in linear space, see FrameBuffer.Linear.
+	GammaCorrection bool
+
+	Deferred bool // light the pixels from the G-buffer once, regardless of overdraw
+
+	// SSAO darkens the ambient light in creases, except with the toon shading.
+	SSAO         bool
+	SSAORadius   float32 // world units
+	SSAOBlur     int     // pixels
+	SSAOStrength float32 // 0..1
+
+	// Toon quantizes the light into bands and outlines the silhouettes.
+	Toon        bool
+	ToonBands   int // per unit of intensity
+	ToonOutline *OutlineEffect
+
+	Picking     bool    // enable the object ID buffer used by Pick
+	Highlighted *Object // outlined in the frame, enables the object ID buffer
+
+	TileOverlay TileOverlay // per-tile metric shown as a heatmap, see TileStats
+
+	// ClipPlanes cut away the scene outside of them while FrustumClipping is enabled.
+	ClipPlanes   []Plane
+	ClipCaps     bool // fill the insides of the cut closed meshes with ClipCapColor
+	ClipCapColor color.RGBA
+
+	DepthMode DepthMode
+
+	DebugView DebugView // surface attributes instead of the shaded image
+
 	DebugEnabled bool
 	DebugInfo    []DebugInfo
 
+	// Per-frame copies of the scene lights, split by the shadow maps.
+	lights           []Light // all lights, including their shadow maps
+	unshadowedLights []Light // all lights, without shadow maps
+	vertexLights     []Light // lights without shadow maps
+	shadowedLights   []Light // lights with shadow maps
+	shadowMaps       []*ShadowMap
+
+	rays    viewRays
+	shading ShadingContext
+
+	scissor image.Rectangle // region of the current viewport
+	views   []drawnViewport // viewports of the last frame
+
+	// Post effects are applied after the scene effects, see Scene.PostEffects.
+	PostProcessing bool
+	PostEffects    []PostEffect
+	effects        []PostEffect // frame chain
+	postFrame      PostFrame
+
+	ambient      RGB // sum of the ambient lights
+	occlusion    []float32
+	occlusionRaw []float32 // before blurring
+
+	gbuffer      *GBuffer
+	geometryPass bool        // rasterize into the G-buffer rather than shading the pixels
+	debugView    DebugView   // DebugView for the frame, may be changed while drawing
+	ssao         bool        // SSAO for the frame, disabled by the debug views and toon shading
+	toneMapping  ToneMapping // ToneMapping for the frame, clamping when HDR is off
+	exposure     float32
+	materials    []*Material // indexed by material ID
+	materialIDs  map[*Material]uint16
+	capTexture   *Texture   // solid ClipCapColor, recreated when the color changes
+	debugDepth   [2]float32 // visible depth range
+
 	toProject chan projectionTask
-	toDraw    chan rasterizationTask
+	toDraw    chan tileTask
 	wg        sync.WaitGroup
 
 	numTiles      uint
-	tileBounds    [maxTiles][2]Vec2
+	gridBounds    [maxTiles][2]Vec2 // tiles of the whole frame buffer
+	tileBounds    [maxTiles][2]Vec2 // tiles clipped to the current viewport, see setScissor
 	tileTriangles [maxTiles][]Triangle
 	tileLocks     [maxTiles]sync.Mutex
 	localBufPool  *sync.Pool // *LocalBuffer
-}
 
-func NewRenderer(fb *FrameBuffer) *Renderer {
-	aspectX := float32(fb.Width) / float32(fb.Height)
-	aspectY := float32(fb.Height) / float32(fb.Width)
+	tileStats      [maxTiles]TileStats
+	tileOverlayMax float32 // metric of the busiest tile
 
-	fovY := float32(45 * (math.Pi / 180))
-	fovX := float32(2 * math.Atan(math.Tan(float64(fovY/2))*float64(aspectX)))
+	pickObjects []*Object // scene objects of the last frame, indexed by object ID - 1
+	highlight   HighlightEffect
+}
 
-	zNear, zFar := float32(0.0), float32(50.0)
-	frustum := NewFrustum(zNear, zFar)
+func NewRenderer(fb *FrameBuffer) *Renderer {
+	frustum := NewFrustum()
+	frustum.SetGuardBand(guardBandSize)
 
 	localBufPool := &sync.Pool{
 		New: func() interface{} {
@@ -134,40 +376,85 @@ func NewRenderer(fb *FrameBuffer) *Renderer {
 		Lighting:        true,
 		FrustumClipping: true,
 		ShowTextures:    true,
-		fovX:            fovX,
-		fovY:            fovY,
-		aspectX:         aspectX,
-		aspectY:         aspectY,
+		Shadows:         true,
+		ToneMapping:     ToneMappingACES,
+		Exposure:        1,
+		GammaCorrection: true,
+		SSAORadius:      0.5,
+		SSAOBlur:        2,
+		SSAOStrength:    1,
+		ToonBands:       3,
+		ToonOutline:     NewOutlineEffect(color.RGBA{20, 20, 20, 255}, 1),
+		highlight:       HighlightEffect{Color: color.RGBA{255, 160, 0, 255}},
+		PostProcessing:  true,
 		frustum:         frustum,
-		zNear:           zNear,
-		zFar:            zFar,
 		numTiles:        1,
 		toProject:       make(chan projectionTask, 256),
-		toDraw:          make(chan rasterizationTask, maxTiles),
+		toDraw:          make(chan tileTask, maxTiles),
 		localBufPool:    localBufPool,
+		materialIDs:     make(map[*Material]uint16),
 	}
 
 	if parallel {
 		r.numTiles = max(uint(runtime.NumCPU()), maxTiles)
 
 		for i := uint(0); i < r.numTiles; i++ {
-			go r.startWorker(i)
+			go r.startWorker()
 		}
 	}
 
+	r.updateTiles()
+
+	return r
+}
+
+// updateTiles splits the frame buffer into the tiles.
+func (r *Renderer) updateTiles() {
 	for i := uint(0); i < r.numTiles; i++ {
-		start, end := calculateTileBoundaries(i, r.numTiles, fb.Width, fb.Height)
-		r.tileBounds[i] = [2]Vec2{start, end}
+		start, end := calculateTileBoundaries(i, r.numTiles, r.fb.Width, r.fb.Height)
+		r.gridBounds[i] = [2]Vec2{start, end}
 	}
 
-	return r
+	r.setScissor(image.Rect(0, 0, r.fb.Width, r.fb.Height))
+}
+
+// Resize changes the size of the frame buffer. The tiles are recomputed, and the buffers
+// sized after the frame are released to be allocated again by the next frame. The workers
+// keep running. It must not be called while a frame is being drawn.
+func (r *Renderer) Resize(width, height int) {
+	if width == r.fb.Width && height == r.fb.Height {
+		return
+	}
+
+	r.fb.Resize(width, height)
+	r.updateTiles()
+
+	r.gbuffer = nil
+	r.occlusion = nil
+	r.occlusionRaw = nil
+	r.views = r.views[:0] // the last frame can no longer be picked
 }
 
 func (r *Renderer) drawProjection(t *Triangle, tile uint) {
-	lightA, lightB, lightC := t.Intensity[0], t.Intensity[1], t.Intensity[2]
-	a, b, c := t.Points[0], t.Points[1], t.Points[2]
-	uvA, uvB, uvC := t.UVs[0], t.UVs[1], t.UVs[2]
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+	)
+
+	if !r.ShowTextures {
+		t.Texture = nil
+		t.NormalMap = nil
+	}
+
+	if r.ShowFaces {
+		r.tileStats[tile].Fragments += r.fb.Triangle(t, &r.shading, int(tileStart.X), int(tileStart.Y), int(tileEnd.X), int(tileEnd.Y))
+	}
+
+	r.drawWireframe(t)
+}
 
+// drawGeometry rasterizes the triangle into the G-buffer for deferred shading.
+func (r *Renderer) drawGeometry(t *Triangle, tile uint) {
 	var (
 		tileStart = r.tileBounds[tile][0]
 		tileEnd   = r.tileBounds[tile][1]
@@ -175,18 +462,17 @@ func (r *Renderer) drawProjection(t *Triangle, tile uint) {
 
 	if !r.ShowTextures {
 		t.Texture = nil
+		t.NormalMap = nil
 	}
 
 	if r.ShowFaces {
-		r.fb.Triangle(
-			int(a.X), int(a.Y), a.W, uvA.U, uvA.V,
-			int(b.X), int(b.Y), b.W, uvB.U, uvB.V,
-			int(c.X), int(c.Y), c.W, uvC.U, uvC.V,
-			int(tileStart.X), int(tileStart.Y), int(tileEnd.X), int(tileEnd.Y),
-			lightA, lightB, lightC,
-			t.Texture,
-		)
+		r.tileStats[tile].Fragments += r.fb.GeometryTriangle(t, r.gbuffer, int(tileStart.X), int(tileStart.Y), int(tileEnd.X), int(tileEnd.Y))
 	}
+}
+
+// drawWireframe draws the triangle edges and vertices, if enabled.
+func (r *Renderer) drawWireframe(t *Triangle) {
+	a, b, c := t.Vertices[0].Position, t.Vertices[1].Position, t.Vertices[2].Position
 
 	if r.ShowEdges {
 		colr := edgeColor
@@ -217,13 +503,192 @@ func (r *Renderer) drawProjection(t *Triangle, tile uint) {
 }
 
 func (r *Renderer) renderTile(tile uint) {
-	for i := range r.tileTriangles[tile] {
-		r.drawProjection(&r.tileTriangles[tile][i], tile)
+	triangles := r.tileTriangles[tile]
+	start := time.Now()
+
+	defer func() {
+		r.tileStats[tile].Triangles += len(triangles)
+		r.tileStats[tile].RasterTime += time.Since(start)
+	}()
+
+	if r.shading.Environment != nil {
+		r.drawEnvironment(tile)
+	} else if r.debugView == DebugViewNone {
+		r.drawDotGrid(tile)
+	}
+
+	if r.geometryPass {
+		for i := range triangles {
+			r.drawGeometry(&triangles[i], tile)
+		}
+	} else {
+		for i := range triangles {
+			r.drawProjection(&triangles[i], tile)
+		}
+	}
+}
+
+// finishTile runs the passes that need the whole frame to be rasterized first.
+func (r *Renderer) finishTile(tile uint) {
+	start := time.Now()
+
+	defer func() {
+		r.tileStats[tile].ShadeTime += time.Since(start)
+	}()
+
+	if r.geometryPass {
+		if r.debugView != DebugViewNone {
+			r.drawDebugView(tile)
+		} else {
+			r.shadeTile(tile)
+		}
+
+		// Wireframe goes on top of the shaded pixels
+		for i := range r.tileTriangles[tile] {
+			r.drawWireframe(&r.tileTriangles[tile][i])
+		}
+	} else if r.ssao {
+		r.applyOcclusion(tile)
+	}
+
+	if r.fb.Colors != nil {
+		tileStart, tileEnd := r.tileBounds[tile][0], r.tileBounds[tile][1]
+		r.fb.ResolveHDR(r.toneMapping, r.exposure, int(tileStart.X), int(tileStart.Y), int(tileEnd.X), int(tileEnd.Y))
+	}
+}
+
+// shadeTile is the lighting pass of deferred shading. World space positions are
+// reconstructed from the depth, so every light is evaluated exactly once per pixel.
+func (r *Renderer) shadeTile(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		g         = r.gbuffer
+		env       = r.shading.Environment
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+
+			zRec := g.Depth[index]
+			if zRec <= 0 {
+				continue
+			}
+
+			var (
+				id       = g.MaterialIDs[index]
+				material = r.materials[id&gbufferMaterialMask]
+				normal   = g.Normals[index]
+				world    = r.shading.Eye.Add(r.rays.Position(x, y, zRec))
+				lights   = r.unshadowedLights
+				light    RGB
+			)
+
+			if id&gbufferReceiveShadows != 0 {
+				lights = r.lights
+			}
+
+			if id&gbufferUnlit != 0 {
+				light = RGB{1, 1, 1}
+			} else {
+				for i := range lights {
+					light = light.Add(lights[i].IlluminateShadowed(world, normal))
+				}
+
+				if r.ssao {
+					occlusion := 1 - r.ambientOcclusion(index)
+					light = light.Add(r.ambient.Multiply(-occlusion))
+				}
+
+				if r.Toon {
+					light = light.Quantize(r.ToonBands)
+				}
+			}
+
+			c := r.fb.decodeColor(g.Albedo[index]).Modulate(light)
+
+			if env != nil && material != nil && material.Reflectivity > 0 {
+				reflection := env.Sample(reflect(world.Sub(r.shading.Eye), normal))
+				c = lerpRGB(c, r.fb.decodeColor(reflection), material.Reflectivity)
+			}
+
+			if r.fb.Colors != nil {
+				r.fb.Colors[index] = c
+			} else {
+				r.fb.Pixels[index] = r.fb.encodeColor(c)
+			}
+		}
+	}
+}
+
+// drawEnvironment fills the tile with the environment as seen from the camera. Since the
+// environment is infinitely far away, only the camera direction matters.
+func (r *Renderer) drawEnvironment(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		env       = r.shading.Environment
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			c := env.Sample(r.rays.At(x, y))
+
+			if r.fb.Colors != nil {
+				r.fb.Colors[y*r.fb.Width+x] = r.fb.decodeColor(c)
+			} else {
+				r.fb.Pixels[y*r.fb.Width+x] = c
+			}
+		}
+	}
+}
+
+// drawDotGrid draws the dots of the grid that fall into the tile. The geometry is drawn
+// over them, like over the rest of the background.
+func (r *Renderer) drawDotGrid(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		if y == 0 || y%dotGridStep != 0 {
+			continue
+		}
+
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			if x == 0 || x%dotGridStep != 0 {
+				continue
+			}
+
+			if r.fb.Colors != nil {
+				r.fb.Colors[y*r.fb.Width+x] = r.fb.decodeColor(dotGridColor)
+			} else {
+				r.fb.Pixels[y*r.fb.Width+x] = dotGridColor
+			}
+		}
+	}
+}
+
+func (r *Renderer) renderShadowTile(sm *ShadowMap, tile uint) {
+	var (
+		tileStart = sm.tileBounds[tile][0]
+		tileEnd   = sm.tileBounds[tile][1]
+	)
+
+	for _, t := range sm.tileTriangles[tile] {
+		sm.depth.DepthTriangle(
+			int(t[0].X), int(t[0].Y), t[0].Z,
+			int(t[1].X), int(t[1].Y), t[1].Z,
+			int(t[2].X), int(t[2].Y), t[2].Z,
+			int(tileStart.X), int(tileStart.Y), int(tileEnd.X), int(tileEnd.Y),
+		)
 	}
 }
 
 // identifyTriangleTiles returns a bitfield of tile numbers that the triangle is visible in.
-func (r *Renderer) identifyTriangleTiles(points *[3]Vec4, tileNums *[maxTiles]uint8) (n int) {
+func (r *Renderer) identifyTriangleTiles(points *[3]Vec4, tileBounds *[maxTiles][2]Vec2, tileNums *[maxTiles]uint8) (n int) {
 	var (
 		// Triangle bounding box
 		minX = min(points[0].X, points[1].X, points[2].X)
@@ -233,7 +698,11 @@ func (r *Renderer) identifyTriangleTiles(points *[3]Vec4, tileNums *[maxTiles]ui
 	)
 
 	for i := uint(0); i < r.numTiles; i++ {
-		start, end := &r.tileBounds[i][0], &r.tileBounds[i][1]
+		start, end := &tileBounds[i][0], &tileBounds[i][1]
+		if start.X == end.X || start.Y == end.Y {
+			continue // outside of the viewport
+		}
+
 		if maxX >= start.X && minX <= end.X && maxY >= start.Y && minY <= end.Y {
 			tileNums[n] = uint8(i)
 			n++
@@ -243,26 +712,33 @@ func (r *Renderer) identifyTriangleTiles(points *[3]Vec4, tileNums *[maxTiles]ui
 	return n
 }
 
+// facingCamera tells if the clip space triangle faces the camera, assuming the counter-clockwise
+// winding, see Material.Winding. The sign of the determinant
+// of the X, Y and W coordinates is the winding order of the triangle on the screen. Unlike the
+// winding order of the projected points, it is also correct for the vertices behind the camera.
 func facingCamera(points *[3]Vec4) bool {
-	v0, v1, v2 := points[0].ToVec3(), points[1].ToVec3(), points[2].ToVec3()
-	faceNormal := v1.Sub(v0).CrossProduct(v2.Sub(v0))
-	return faceNormal.DotProduct(Vec3{0, 0, 0}.Sub(v0)) > 0
+	p0, p1, p2 := &points[0], &points[1], &points[2]
+
+	det := p0.X*(p1.Y*p2.W-p2.Y*p1.W) -
+		p1.X*(p0.Y*p2.W-p2.Y*p0.W) +
+		p2.X*(p0.Y*p1.W-p1.Y*p0.W)
+
+	return det < 0
 }
 
 // projectObject projects the object to the screen space. Object’s Face projections are
 // stored in the corresponding tileTriangle buffers for later rasterization.
-func (r *Renderer) projectObject(object *Object, camera *Camera) {
+func (r *Renderer) projectObject(object *Object, objectID uint32, camera *Camera) {
 	worldMatrix := NewWorldMatrix(object.Scale, object.Rotation, object.Translation)
 	viewMatrix := NewViewMatrix(camera.Position, camera.Direction, camera.Up)
-	perspectiveMatrix := NewPerspectiveMatrix(r.fovY, r.aspectX, r.zNear, r.zFar)
+	projectionMatrix := r.projection
 
 	mvpMatrix := NewIdentityMatrix()
-	mvpMatrix = mvpMatrix.Multiply(perspectiveMatrix)
+	mvpMatrix = mvpMatrix.Multiply(projectionMatrix)
 	mvpMatrix = mvpMatrix.Multiply(viewMatrix)
 	mvpMatrix = mvpMatrix.Multiply(worldMatrix)
 
-	screenMatrix := NewScreenMatrix(r.fb.Width, r.fb.Height)
-	lightDirection := Vec3{X: -1, Y: 1, Z: 1}.Normalize()
+	screenMatrix := r.screen
 
 	// Transform the bounding box to clip space
 	bbox := object.BoundingBox
@@ -274,17 +750,31 @@ func (r *Renderer) projectObject(object *Object, camera *Camera) {
 		return
 	}
 
+	// Back faces of the objects cut by the user planes are visible through the cut
+	capped := false
+
+	if len(r.frustum.userPlanes) != 0 {
+		worldBox := object.BoundingBox
+		matrixMultiplyVec4Batch(&worldMatrix, worldBox[:])
+
+		userVisibility := r.frustum.UserBoxVisibility(&worldBox)
+		if userVisibility == BoxVisibilityOutside {
+			return
+		}
+
+		boxVisibility = min(boxVisibility, userVisibility)
+		capped = r.ClipCaps && userVisibility == BoxVisibilityIntersect
+	}
+
 	var (
 		tileNums [maxTiles]uint8
 
 		// Original triangle points
-		vertices        [3]Vec4
-		vertexIntensity [3]float32
+		points   [3]Vec4
+		vertices [3]Vertex
 
-		// New points after frustum clipping
-		clipVertices  [maxClipPoints][3]Vec4
-		clipIntensity [maxClipPoints][3]float32
-		clipUV        [maxClipPoints][3]UV
+		// New triangles after frustum clipping
+		clipTriangles [maxClipPoints][3]Vertex
 		clipCount     int
 	)
 
@@ -303,81 +793,192 @@ func (r *Renderer) projectObject(object *Object, camera *Camera) {
 	copy(object.TransformedVertices, object.Vertices)
 	matrixMultiplyVec4Batch(&mvpMatrix, object.TransformedVertices)
 
-	// Transform the normals to world space (for light calculation)
+	// Transform the vertices and normals to world space (for light calculation)
+	copy(object.WorldVertices, object.Vertices)
+	matrixMultiplyVec4Batch(&worldMatrix, object.WorldVertices)
 	copy(object.WorldFaceNormals, object.FaceNormals)
 	copy(object.WorldVertexNormals, object.VertexNormals)
 	matrixMultiplyVec4Batch(&worldMatrix, object.WorldFaceNormals)
 	matrixMultiplyVec4Batch(&worldMatrix, object.WorldVertexNormals)
+	copy(object.WorldTangents, object.Tangents)
+	copy(object.WorldBitangents, object.Bitangents)
+	matrixMultiplyVec4Batch(&worldMatrix, object.WorldTangents)
+	matrixMultiplyVec4Batch(&worldMatrix, object.WorldBitangents)
 
 	// Objects without vertex normals are lit by face normals
 	hasVertexNormals := len(object.VertexNormals) != 0
 
+	// Shadowed lights are evaluated per pixel, as the shadow edges may cross the triangle
+	receiveShadows := object.ReceiveShadows && len(r.shadowedLights) != 0
+
+	lightBands := 0
+	if r.Toon {
+		lightBands = r.ToonBands
+	}
+
 	for fi := range object.Faces {
 		face := &object.Faces[fi] // avoid face copy
 
-		vertices[0] = object.TransformedVertices[face.VertexIndices[0]]
-		vertices[1] = object.TransformedVertices[face.VertexIndices[1]]
-		vertices[2] = object.TransformedVertices[face.VertexIndices[2]]
+		points[0] = object.TransformedVertices[face.VertexIndices[0]]
+		points[1] = object.TransformedVertices[face.VertexIndices[1]]
+		points[2] = object.TransformedVertices[face.VertexIndices[2]]
+
+		var (
+			texture, normalMap        *Texture
+			vertexLights, pixelLights []Light
+			reflectivity              float32
+			cullMode                  = CullBack
+			winding                   = WindingCounterClockwise
+		)
+
+		if face.Material != nil {
+			texture = face.Material.Texture
+			normalMap = face.Material.NormalMap
+			reflectivity = face.Material.Reflectivity
+			cullMode = face.Material.CullMode
+			winding = face.Material.Winding
+		}
+
+		if !r.BackfaceCulling {
+			cullMode = CullNone
+		}
 
-		if r.BackfaceCulling && !facingCamera(&vertices) {
+		// The rasterizer only accepts the counter-clockwise triangles on the screen
+		counterClockwise := facingCamera(&points)
+		backFace := counterClockwise == (winding == WindingClockwise)
+
+		// Caps replace the back faces, whatever the cull mode is
+		capFace := capped && backFace
+
+		if !capFace && ((cullMode == CullBack && backFace) || (cullMode == CullFront && !backFace)) {
 			continue
 		}
 
-		if r.Lighting {
-			if hasVertexNormals && !r.FlatShading {
-				vn0 := object.WorldVertexNormals[face.NormalIndices[0]].Normalize().ToVec3()
-				vn1 := object.WorldVertexNormals[face.NormalIndices[1]].Normalize().ToVec3()
-				vn2 := object.WorldVertexNormals[face.NormalIndices[2]].Normalize().ToVec3()
-				vertexIntensity[0] = ambientStrength + vn0.DotProduct(lightDirection)*diffuseStrength
-				vertexIntensity[1] = ambientStrength + vn1.DotProduct(lightDirection)*diffuseStrength
-				vertexIntensity[2] = ambientStrength + vn2.DotProduct(lightDirection)*diffuseStrength
-			} else {
-				fn := object.WorldFaceNormals[fi].Normalize().ToVec3()
-				diffuse := fn.DotProduct(lightDirection) * diffuseStrength
-				intensity := ambientStrength + diffuse
-				vertexIntensity[0] = intensity
-				vertexIntensity[1] = intensity
-				vertexIntensity[2] = intensity
+		if capFace {
+			texture, normalMap, reflectivity = r.capTexture, nil, 0
+		}
+
+		// Faces seen from behind are lit from the visible side
+		normalSign := float32(1)
+		if backFace {
+			normalSign = -1
+		}
+
+		// Face normals are calculated for the counter-clockwise winding
+		faceNormalSign := normalSign
+		if winding == WindingClockwise {
+			faceNormalSign = -faceNormalSign
+		}
+
+		switch {
+		case r.geometryPass, capFace:
+			// All lights are evaluated in the lighting pass, caps are not lit
+		case normalMap != nil:
+			// Normal is only known per pixel, all lights are evaluated in the rasterizer
+			pixelLights = r.unshadowedLights
+			if receiveShadows {
+				pixelLights = r.lights
+			}
+		case receiveShadows:
+			vertexLights = r.vertexLights
+			pixelLights = r.shadowedLights
+		default:
+			vertexLights = r.unshadowedLights
+		}
+
+		for i := range vertices {
+			vertices[i].Position = points[i]
+			vertices[i].UV = face.UVs[i]
+			vertices[i].World = object.WorldVertices[face.VertexIndices[i]].ToVec3()
+		}
+
+		if hasVertexNormals && !r.FlatShading {
+			for i := range vertices {
+				v := &vertices[i]
+				v.Normal = object.WorldVertexNormals[face.NormalIndices[i]].Normalize().ToVec3().Multiply(normalSign)
+				v.Light = illuminate(vertexLights, v.World, v.Normal)
 			}
 		} else {
-			vertexIntensity[0] = ambientStrength
-			vertexIntensity[1] = ambientStrength
-			vertexIntensity[2] = ambientStrength
+			center := vertices[0].World.Add(vertices[1].World).Add(vertices[2].World).Divide(3)
+			fn := object.WorldFaceNormals[fi].Normalize().ToVec3().Multiply(faceNormalSign)
+			light := illuminate(vertexLights, center, fn)
+
+			for i := range vertices {
+				vertices[i].Normal = fn
+				vertices[i].Light = light
+			}
+		}
+
+		if normalMap != nil {
+			for i := range vertices {
+				v := &vertices[i]
+				v.Tangent, v.Bitangent = tangentBasis(
+					v.Normal,
+					object.WorldTangents[face.VertexIndices[i]].ToVec3(),
+					object.WorldBitangents[face.VertexIndices[i]].ToVec3(),
+				)
+			}
+		}
+
+		if capFace {
+			for i := range vertices {
+				vertices[i].Light = RGB{1, 1, 1}
+			}
+		}
+
+		if !counterClockwise {
+			vertices[1], vertices[2] = vertices[2], vertices[1]
 		}
 
 		// Clip triangles if object is not fully inside the frustum
 		if r.FrustumClipping && boxVisibility != BoxVisibilityInside {
-			clipCount = r.frustum.ClipTriangle(
-				&vertices, &face.UVs, &vertexIntensity,
-				&clipVertices, &clipUV, &clipIntensity,
-			)
+			clipCount = r.frustum.ClipTriangle(&vertices, &clipTriangles)
 		} else {
-			clipIntensity[0] = vertexIntensity
-			clipVertices[0] = vertices
-			clipUV[0] = face.UVs
+			clipTriangles[0] = vertices
 			clipCount = 1
 		}
 
+		materialID, bands := r.materialIDs[face.Material], lightBands
+
+		switch {
+		case capFace:
+			materialID, bands = gbufferUnlit, 0
+		case receiveShadows:
+			materialID |= gbufferReceiveShadows
+		}
+
 		for i := 0; i < clipCount; i++ {
-			screenPoints := clipVertices[i]
-
-			// Perspective divide
-			for j := range screenPoints {
-				origW := screenPoints[j].W
-				screenPoints[j] = screenPoints[j].Divide(screenPoints[j].W)
-				matrixMultiplyVec4Inplace(&screenMatrix, &screenPoints[j])
-				screenPoints[j].W = origW
+			triangle := Triangle{
+				Vertices:     clipTriangles[i],
+				Texture:      texture,
+				NormalMap:    normalMap,
+				PixelLights:  pixelLights,
+				Reflectivity: reflectivity,
+				MaterialID:   materialID,
+				LightBands:   bands,
+				ObjectID:     objectID,
+				FaceID:       uint32(fi),
 			}
 
-			triangle := Triangle{
-				Points:    screenPoints,
-				UVs:       clipUV[i],
-				Texture:   face.Texture,
-				Intensity: clipIntensity[i],
+			// Perspective divide, Z is replaced with the depth buffer value
+			for j := range triangle.Vertices {
+				p := &triangle.Vertices[j].Position
+
+				zRec := r.rays.EncodeDepth(*p)
+				origW := p.W
+				*p = p.Divide(p.W)
+				matrixMultiplyVec4Inplace(&screenMatrix, p)
+				p.Z = zRec
+				p.W = origW
+				points[j] = *p
+			}
+
+			if object.DepthBias != 0 || object.SlopeDepthBias != 0 {
+				triangle.DepthBias = depthBias(&points, object.DepthBias, object.SlopeDepthBias)
 			}
 
 			// Identify the tiles that the triangle is visible in
-			for n := range r.identifyTriangleTiles(&screenPoints, &tileNums) {
+			for n := range r.identifyTriangleTiles(&points, &r.tileBounds, &tileNums) {
 				tile := tileNums[n]
 
 				// Add triangle to the corresponding local tile buffer
@@ -406,78 +1007,425 @@ func (r *Renderer) projectObject(object *Object, camera *Camera) {
 	}
 }
 
-func (r *Renderer) startWorker(tile uint) {
+// projectShadowCaster projects the object to the shadow map space. Triangles are stored in
+// the shadow map tile buffers for later rasterization into the depth buffer.
+func (r *Renderer) projectShadowCaster(object *Object, sm *ShadowMap) {
+	worldMatrix := NewWorldMatrix(object.Scale, object.Rotation, object.Translation)
+	matrix := sm.clip.Multiply(worldMatrix)
+
+	var (
+		tileNums      [maxTiles]uint8
+		points        [3]Vec4
+		vertices      [3]Vertex
+		clipTriangles [maxClipPoints][3]Vertex
+	)
+
+	localBuf := r.localBufPool.Get().(*LocalBuffer)
+	defer r.localBufPool.Put(localBuf)
+	tileTriangles := &localBuf.shadowTriangles
+	tileTriangleCount := &localBuf.shadowTriangleCount
+
+	for i := range tileTriangleCount {
+		tileTriangleCount[i] = 0
+	}
+
+	copy(object.TransformedVertices, object.Vertices)
+	matrixMultiplyVec4Batch(&matrix, object.TransformedVertices)
+
+	for fi := range object.Faces {
+		face := &object.Faces[fi]
+
+		for i := range vertices {
+			vertices[i] = Vertex{Position: object.TransformedVertices[face.VertexIndices[i]]}
+		}
+
+		// Triangles crossing the spot light’s near plane are cut at it
+		clipCount := sm.frustum.ClipTriangle(&vertices, &clipTriangles)
+
+		for ci := 0; ci < clipCount; ci++ {
+			for j := range points {
+				p := clipTriangles[ci][j].Position.Divide(clipTriangles[ci][j].Position.W)
+				matrixMultiplyVec4Inplace(&sm.screen, &p)
+				points[j] = p
+			}
+
+			for n := range r.identifyTriangleTiles(&points, &sm.tileBounds, &tileNums) {
+				tile := tileNums[n]
+
+				tileTriangles[tile][tileTriangleCount[tile]] = points
+				tileTriangleCount[tile]++
+
+				if tileTriangleCount[tile] == len(tileTriangles[tile]) {
+					sm.tileLocks[tile].Lock()
+					sm.tileTriangles[tile] = append(sm.tileTriangles[tile], tileTriangles[tile][:]...)
+					sm.tileLocks[tile].Unlock()
+					tileTriangleCount[tile] = 0
+				}
+			}
+		}
+	}
+
+	for tile := range tileTriangles {
+		if tileTriangleCount[tile] != 0 {
+			sm.tileLocks[tile].Lock()
+			sm.tileTriangles[tile] = append(sm.tileTriangles[tile], tileTriangles[tile][:tileTriangleCount[tile]]...)
+			sm.tileLocks[tile].Unlock()
+			tileTriangleCount[tile] = 0
+		}
+	}
+}
+
+func (r *Renderer) startWorker() {
 	for {
 		select {
 		case task := <-r.toProject:
-			r.projectObject(task.object, task.camera)
+			if task.shadowMap != nil {
+				r.projectShadowCaster(task.object, task.shadowMap)
+			} else {
+				r.projectObject(task.object, task.objectID, task.camera)
+			}
 			r.wg.Done()
-		case <-r.toDraw:
-			r.renderTile(tile)
+		case task := <-r.toDraw:
+			task.pass(task.tile)
 			r.wg.Done()
 		}
 	}
 }
 
-func (r *Renderer) drawTilesBoundaries() {
-	for i := uint(0); i < r.numTiles; i++ {
-		var (
-			start = r.tileBounds[i][0]
-			end   = r.tileBounds[i][1]
-		)
+// runTiles runs the pass for every tile and waits until all tiles are done. Passes that
+// read the pixels of the neighbouring tiles must be separated by a runTiles call.
+func (r *Renderer) runTiles(pass func(tile uint)) {
+	if !parallel {
+		for tile := uint(0); tile < r.numTiles; tile++ {
+			pass(tile)
+		}
 
-		r.fb.Line(int(start.X), int(start.Y), int(end.X), int(start.Y), color.RGBA{255, 0, 0, 255})
-		r.fb.Line(int(end.X), int(start.Y), int(end.X), int(end.Y), color.RGBA{255, 0, 0, 255})
-		r.fb.Line(int(end.X), int(end.Y), int(start.X), int(end.Y), color.RGBA{255, 0, 0, 255})
-		r.fb.Line(int(start.X), int(end.Y), int(start.X), int(start.Y), color.RGBA{255, 0, 0, 255})
+		return
+	}
+
+	r.wg.Add(int(r.numTiles))
+	for tile := uint(0); tile < r.numTiles; tile++ {
+		r.toDraw <- tileTask{tile: tile, pass: pass}
 	}
+	r.wg.Wait()
 }
 
 func (r *Renderer) updateStats() {
 	r.TPF = 0
 	for i := range r.numTiles {
-		r.TPF += len(r.tileTriangles[i])
+		r.TPF += r.tileStats[i].Triangles
+	}
+}
+
+// drawShadowMaps renders the depth of the shadow casting objects from the point of view
+// of each light that casts shadows, and assigns the shadow maps to the frame lights.
+func (r *Renderer) drawShadowMaps(objects []*Object) {
+	var (
+		casters        []*Object
+		center, radius = sceneBounds(objects)
+		numMaps        = 0
+	)
+
+	for _, object := range objects {
+		if object.CastShadows {
+			casters = append(casters, object)
+		}
+	}
+
+	for i := range r.lights {
+		light := &r.lights[i]
+		if !light.CastShadows || !light.CanCastShadows() {
+			continue
+		}
+
+		if numMaps == len(r.shadowMaps) {
+			r.shadowMaps = append(r.shadowMaps, NewShadowMap(shadowMapSize, r.numTiles))
+		}
+
+		sm := r.shadowMaps[numMaps]
+		sm.Update(light, center, radius)
+		light.shadowMap = sm
+		numMaps++
+
+		if parallel {
+			r.wg.Add(len(casters))
+			for _, object := range casters {
+				r.toProject <- projectionTask{object: object, shadowMap: sm}
+			}
+			r.wg.Wait()
+		} else {
+			for _, object := range casters {
+				r.projectShadowCaster(object, sm)
+			}
+		}
+
+		r.runTiles(func(tile uint) {
+			r.renderShadowTile(sm, tile)
+		})
 	}
 }
 
-func (r *Renderer) Draw(objects []*Object, camera *Camera) {
+// updateMaterials assigns G-buffer IDs to the materials of the objects. ID 0 is reserved
+// for faces without a material.
+func (r *Renderer) updateMaterials(objects []*Object) {
+	var last *Material
+
+	clear(r.materialIDs)
+	r.materials = append(r.materials[:0], nil)
+
+	for _, object := range objects {
+		for i := range object.Faces {
+			// Neighbouring faces usually share the material
+			material := object.Faces[i].Material
+			if material == last || material == nil {
+				continue
+			}
+
+			last = material
+
+			if _, ok := r.materialIDs[material]; !ok && len(r.materials) <= gbufferMaterialMask {
+				r.materialIDs[material] = uint16(len(r.materials))
+				r.materials = append(r.materials, material)
+			}
+		}
+	}
+}
+
+// ExportGBuffer writes the G-buffer of the last deferred frame as PNG images.
+// It must not be called while a frame is being drawn.
+func (r *Renderer) ExportGBuffer(dir string) error {
+	if r.gbuffer == nil {
+		return fmt.Errorf("no deferred frame has been drawn yet")
+	}
+
+	return r.gbuffer.Export(dir)
+}
+
+// Draw renders the scene from the camera into the whole frame buffer.
+func (r *Renderer) Draw(scene *Scene, camera *Camera) {
+	r.DrawViewports(scene, []Viewport{{Camera: camera}})
+}
+
+// DrawViewports renders the scene into each of the viewports in order, so the later ones
+// are drawn over the earlier ones where they overlap. Shadow maps and the other per-frame
+// state are shared by the viewports, while the tiles are clipped to each viewport in turn.
+func (r *Renderer) DrawViewports(scene *Scene, viewports []Viewport) {
+	objects := scene.Objects
+
+	// Lights can be moved while the frame is being drawn
+	r.lights = r.lights[:0]
+	for _, light := range scene.Lights {
+		if r.Lighting || light.Type == LightTypeAmbient {
+			r.lights = append(r.lights, *light)
+			r.lights[len(r.lights)-1].prepare()
+		}
+	}
+
+	if r.Shadows {
+		r.drawShadowMaps(objects)
+	}
+
+	r.unshadowedLights = r.unshadowedLights[:0]
+	r.vertexLights = r.vertexLights[:0]
+	r.shadowedLights = r.shadowedLights[:0]
+	r.ambient = RGB{}
+
+	for _, light := range r.lights {
+		if light.Type == LightTypeAmbient {
+			r.ambient = r.ambient.Add(light.radiance)
+		}
+
+		if light.shadowMap != nil {
+			r.shadowedLights = append(r.shadowedLights, light)
+		} else {
+			r.vertexLights = append(r.vertexLights, light)
+		}
+
+		light.shadowMap = nil
+		r.unshadowedLights = append(r.unshadowedLights, light)
+	}
+
+	// Options that change the passes are read once, so that all viewports and tiles agree
+	r.debugView = r.DebugView
+	debug := r.debugView != DebugViewNone
+	r.ssao = r.SSAO && !debug && !r.Toon
+	ssao := r.ssao
+
+	if r.FrustumClipping {
+		r.frustum.SetUserPlanes(r.ClipPlanes)
+	} else {
+		r.frustum.SetUserPlanes(nil)
+	}
+
+	if r.ClipCaps && (r.capTexture == nil || r.capTexture.color != r.ClipCapColor) {
+		r.capTexture = NewColorTexture(r.ClipCapColor)
+	}
+
+	r.geometryPass = r.Deferred || debug
+
+	if r.geometryPass || ssao {
+		if r.gbuffer == nil {
+			r.gbuffer = NewGBuffer(r.fb)
+			r.gbuffer.view = &r.rays
+		}
+	}
+
+	if debug {
+		r.gbuffer.enableDebug()
+		clear(r.gbuffer.Overdraw)
+	}
+
+	// Forward shaded pixels keep their albedo and material for the ambient occlusion pass
+	forwardSSAO := ssao && !r.geometryPass
+
+	if r.geometryPass || forwardSSAO {
+		r.updateMaterials(objects)
+	}
+
+	if ssao && r.occlusion == nil {
+		r.occlusion = make([]float32, r.fb.Width*r.fb.Height)
+		r.occlusionRaw = make([]float32, r.fb.Width*r.fb.Height)
+	}
+
+	// Debug colors are written to the pixels as is. Ambient occlusion of the forward shaded
+	// pixels needs the colors before they are clamped, so they are resolved without HDR too.
+	r.fb.EnableHDR((r.HDR && !debug) || forwardSSAO)
+
+	r.toneMapping, r.exposure = r.ToneMapping, r.Exposure
+	if !r.HDR {
+		r.toneMapping, r.exposure = ToneMappingClamp, 1
+	}
+
+	r.fb.Linear = r.GammaCorrection && !debug
+
+	r.fb.EnableIDBuffer(r.Picking || r.Highlighted != nil)
+	r.pickObjects = append(r.pickObjects[:0], objects...)
+
+	r.fb.Clear(backgroundColor)
+	r.resetTileStats()
+	r.views = r.views[:0]
+
+	for i := range viewports {
+		r.drawViewport(scene, &viewports[i], i > 0)
+	}
+
+	// Overlays and the caller are not limited to the last viewport
+	r.setScissor(image.Rect(0, 0, r.fb.Width, r.fb.Height))
+
+	if r.TileOverlay != TileOverlayNone {
+		r.drawTileOverlays()
+	}
+
+	r.updateStats()
+}
+
+// drawViewport renders the scene from the viewport camera into its region of the frame
+// buffer. Unless it is the first one, the region is cleared first.
+func (r *Renderer) drawViewport(scene *Scene, viewport *Viewport, clearRegion bool) {
+	var (
+		objects       = scene.Objects
+		camera        = viewport.Camera
+		debug         = r.debugView != DebugViewNone
+		rect, scissor = viewport.bounds(r.fb.Width, r.fb.Height)
+	)
+
+	if scissor.Empty() {
+		return
+	}
+
+	r.setScissor(scissor)
+
 	for i := uint(0); i < r.numTiles; i++ {
 		r.tileTriangles[i] = r.tileTriangles[i][:0]
 	}
 
-	r.fb.Clear(color.RGBA{50, 50, 50, 255})
-	r.fb.DotGrid(color.RGBA{100, 100, 100, 255}, 10)
+	// Camera projection can change between frames
+	r.rays = newViewRays(camera, r.DepthMode, rect)
+	r.projection = camera.ProjectionMatrix(float32(rect.Dx())/float32(rect.Dy()), r.DepthMode)
+	r.screen = NewViewportMatrix(rect.Min.X, rect.Min.Y, rect.Dx(), rect.Dy())
+	r.fb.logDepthFar, r.fb.logDepthScale = r.rays.zFar, 0
+
+	if r.rays.depthMode == DepthLogarithmic {
+		r.fb.logDepthScale = r.rays.logScale
+	}
+
+	r.shading = ShadingContext{
+		Eye: camera.Position,
+	}
+
+	if !debug {
+		r.shading.Environment = scene.Environment
+	}
+
+	if r.ssao && !r.geometryPass {
+		// Ambient occlusion needs the albedo of the forward shaded pixels
+		r.shading.GBuffer = r.gbuffer
+	}
+
+	if clearRegion {
+		r.runTiles(r.clearTile)
+	}
 
 	if parallel {
 		r.wg.Add(len(objects))
 		for i := range objects {
 			r.toProject <- projectionTask{
-				object: objects[i],
-				camera: camera,
+				object:   objects[i],
+				objectID: uint32(i + 1),
+				camera:   camera,
 			}
 		}
 		r.wg.Wait()
-
-		r.wg.Add(int(r.numTiles))
-		for i := uint(0); i < r.numTiles; i++ {
-			r.toDraw <- rasterizationTask{tile: i}
-		}
-		r.wg.Wait()
 	} else {
 		for i := range objects {
-			r.projectObject(objects[i], camera)
+			r.projectObject(objects[i], uint32(i+1), camera)
 		}
+	}
 
-		for i := uint(0); i < r.numTiles; i++ {
-			r.renderTile(i)
+	r.runTiles(r.renderTile)
+
+	if r.ssao {
+		r.runTiles(r.computeOcclusion)
+		r.runTiles(r.blurOcclusion)
+	}
+
+	if r.debugView == DebugViewDepth {
+		r.debugDepth[0], r.debugDepth[1] = r.gbuffer.depthRange(scissor)
+	}
+
+	r.runTiles(r.finishTile)
+
+	r.effects = r.effects[:0]
+
+	if !debug {
+		if r.Toon && r.ToonOutline != nil {
+			r.effects = append(r.effects, r.ToonOutline)
+		}
+
+		if scene.Fog.Mode != FogModeNone {
+			r.effects = append(r.effects, &FogEffect{Fog: scene.Fog})
 		}
+
+		if r.PostProcessing {
+			r.effects = append(r.effects, scene.PostEffects...)
+			r.effects = append(r.effects, r.PostEffects...)
+		}
+	}
+
+	if id := r.objectID(r.Highlighted); id != 0 {
+		r.highlight.ObjectID = id
+		r.effects = append(r.effects, &r.highlight)
 	}
 
 	if !demoMode {
-		//r.drawTilesBoundaries()
-		r.fb.CrossHair(color.RGBA{255, 255, 0, 255})
-		//r.fb.Fog(0.100, 0.033, color.RGBA{100, 100, 100, 255})
+		r.effects = append(r.effects, &CrossHairEffect{Color: color.RGBA{255, 255, 0, 255}})
 	}
 
-	r.updateStats()
+	r.postProcess(r.effects)
+
+	r.views = append(r.views, drawnViewport{
+		scissor: scissor,
+		rays:    r.rays,
+		eye:     camera.Position,
+	})
 }
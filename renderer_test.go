@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"runtime"
+	"testing"
+)
+
+// newRoomMesh returns a box with the faces pointing inwards. Each wall is a grid of n×n quads.
+func newRoomMesh(size float32, n int) *Mesh {
+	var (
+		vertices []Vec4
+		faces    []Face
+		half     = size / 2
+		step     = size / float32(n)
+	)
+
+	for _, normal := range []Vec3{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+		u := Vec3{normal.Y, normal.Z, normal.X} // any axis perpendicular to the normal
+		v := normal.CrossProduct(u)
+		corner := normal.Multiply(-half).Sub(u.Multiply(half)).Sub(v.Multiply(half))
+		first := len(vertices)
+
+		for j := 0; j <= n; j++ {
+			for i := 0; i <= n; i++ {
+				p := corner.Add(u.Multiply(float32(i) * step)).Add(v.Multiply(float32(j) * step))
+				vertices = append(vertices, p.ToVec4())
+			}
+		}
+
+		for j := 0; j < n; j++ {
+			for i := 0; i < n; i++ {
+				v00 := first + j*(n+1) + i
+				v10, v01, v11 := v00+1, v00+n+1, v00+n+2
+
+				faces = append(faces,
+					Face{VertexIndices: [3]int{v00, v10, v11}, UVs: [3]UV{{0, 0}, {1, 0}, {1, 1}}},
+					Face{VertexIndices: [3]int{v00, v11, v01}, UVs: [3]UV{{0, 0}, {1, 1}, {0, 1}}},
+				)
+			}
+		}
+	}
+
+	return NewMesh(vertices, nil, faces)
+}
+
+// BenchmarkRenderer_InsideGeometry renders the frame from inside a large mesh, where most
+// of the visible triangles cross the screen edges, with and without the clipping guard band.
+// Project only measures the projection and clipping of the triangles, without rasterization.
+func BenchmarkRenderer_InsideGeometry(b *testing.B) {
+	object := NewObject(newRoomMesh(20, 16))
+	scene := &Scene{
+		Objects: []*Object{object},
+		Lights:  DefaultLights(),
+		Fog:     DefaultFog(),
+	}
+
+	camera := NewCamera(Vec3{2, -3, 4}, Vec3{0.3, -0.2, -1})
+
+	for _, guardBand := range []float32{1, guardBandSize} {
+		renderer := newTestRenderer(640, 480)
+		renderer.frustum.SetGuardBand(guardBand)
+
+		b.Run(fmt.Sprintf("Draw/GuardBand=%g", guardBand), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				renderer.Draw(scene, camera)
+			}
+		})
+
+		b.Run(fmt.Sprintf("Project/GuardBand=%g", guardBand), func(b *testing.B) {
+			renderer.Draw(scene, camera) // prepare the frame state
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				for tile := range renderer.tileTriangles {
+					renderer.tileTriangles[tile] = renderer.tileTriangles[tile][:0]
+				}
+
+				renderer.projectObject(object, 1, camera)
+			}
+		})
+	}
+}
+
+func TestViewRays_Depth(t *testing.T) {
+	camera := NewCamera(Vec3{}, Vec3{0, 0, -1})
+	camera.Near, camera.Far = 0.1, 1000
+
+	for _, projection := range []Projection{ProjectionPerspective, ProjectionOrthographic} {
+		for _, mode := range []DepthMode{DepthReversed, DepthStandard, DepthLogarithmic} {
+			camera.Projection = projection
+			rays := newViewRays(camera, mode, image.Rect(0, 0, 64, 48))
+			projectionMatrix := camera.ProjectionMatrix(64.0/48, mode)
+
+			for _, depth := range []float32{camera.Near, 1, 42, 500, camera.Far} {
+				p := Vec4{0, 0, depth, 1} // view space Z grows along the camera direction
+				matrixMultiplyVec4Inplace(&projectionMatrix, &p)
+				zRec := rays.EncodeDepth(p)
+
+				switch {
+				case depth == camera.Near && abs(zRec-1) > 1e-5:
+					t.Errorf("%s, %s: near plane is stored as %g, want 1", projection, mode, zRec)
+				case depth == camera.Far && abs(zRec) > 1e-5:
+					t.Errorf("%s, %s: far plane is stored as %g, want 0", projection, mode, zRec)
+				}
+
+				if got := rays.Depth(zRec); abs(got-depth) > 1e-3*depth {
+					t.Errorf("%s, %s: depth %g is decoded as %g", projection, mode, depth, got)
+				}
+			}
+		}
+	}
+}
+
+// TestRenderer_LogarithmicDepth compares the depth of a floor stretching to the horizon with
+// the reversed depth, which is exact on flat surfaces, so the depth test between intersecting
+// surfaces is as accurate in both modes.
+func TestRenderer_LogarithmicDepth(t *testing.T) {
+	scene := &Scene{
+		Objects: []*Object{newQuadObject(Vec3{0, -1, -250}, Vec3{0, 1, 0}, 500)},
+		Lights:  DefaultLights(),
+	}
+
+	camera := NewCamera(Vec3{}, Vec3{0, 0, -1})
+	camera.Near, camera.Far = 0.1, 1000
+
+	depths := func(mode DepthMode) []float32 {
+		renderer := newTestRenderer(64, 48)
+		renderer.DepthMode = mode
+		renderer.Draw(scene, camera)
+
+		depths := make([]float32, len(renderer.fb.ZBuffer))
+		for i, zRec := range renderer.fb.ZBuffer {
+			if zRec > 0 {
+				depths[i] = renderer.rays.Depth(zRec)
+			}
+		}
+
+		return depths
+	}
+
+	var (
+		want    = depths(DepthReversed)
+		got     = depths(DepthLogarithmic)
+		covered = 0
+	)
+
+	for i := range want {
+		if (want[i] == 0) != (got[i] == 0) {
+			t.Fatalf("pixel %d is covered in only one of the modes", i)
+		}
+
+		if want[i] != 0 {
+			covered++
+
+			if abs(got[i]-want[i]) > 1e-3*want[i] {
+				t.Errorf("pixel %d: depth is %g, want %g", i, got[i], want[i])
+			}
+		}
+	}
+
+	if covered == 0 {
+		t.Fatal("floor is not visible")
+	}
+}
+
+// TestRenderer_DepthModes draws two parallel surfaces far from the camera, 5 cm apart. The
+// closer one is drawn first, so the other one shows through wherever the depth values collide.
+func TestRenderer_DepthModes(t *testing.T) {
+	closer := newQuadObject(Vec3{0, 0, -499.95}, Vec3{0, 0, 1}, 2000)
+	farther := newQuadObject(Vec3{0, 0, -500}, Vec3{0, 0, 1}, 2000)
+
+	scene := &Scene{
+		Objects: []*Object{mergeObjects(closer, farther)},
+		Lights:  DefaultLights(),
+	}
+
+	camera := NewCamera(Vec3{}, Vec3{0, 0, -1})
+	camera.Near, camera.Far = 0.1, 1000
+
+	tests := map[DepthMode]bool{
+		DepthReversed:    true,
+		DepthLogarithmic: true,
+		DepthStandard:    false, // not enough precision far from the near plane
+	}
+
+	for mode, separated := range tests {
+		t.Run(mode.String(), func(t *testing.T) {
+			renderer := newTestRenderer(64, 48)
+			renderer.Picking = true
+			renderer.DepthMode = mode
+			renderer.Draw(scene, camera)
+
+			covered, farther := 0, 0
+
+			for i, id := range renderer.fb.ObjectIDs {
+				if id != 0 {
+					covered++
+
+					if renderer.fb.FaceIDs[i] >= 2 {
+						farther++
+					}
+				}
+			}
+
+			if covered != len(renderer.fb.ObjectIDs) {
+				t.Fatalf("%d of %d pixels are covered", covered, len(renderer.fb.ObjectIDs))
+			}
+
+			if separated && farther != 0 {
+				t.Errorf("farther surface is visible in %d pixels", farther)
+			} else if !separated && farther == 0 {
+				t.Errorf("surfaces are separated, the test does not show the precision loss")
+			}
+		})
+	}
+}
+
+func TestRenderer_Resize(t *testing.T) {
+	scene := &Scene{
+		Objects: []*Object{NewObject(newRoomMesh(2, 1))},
+		Lights:  DefaultLights(),
+	}
+
+	renderer := newTestRenderer(64, 48)
+	renderer.BackfaceCulling = false // the room faces point inwards
+	renderer.Picking = true
+	renderer.SSAO = true
+
+	camera := NewCamera(Vec3{0, 0, 5}, Vec3{0, 0, -1})
+	renderer.Draw(scene, camera)
+
+	goroutines := runtime.NumGoroutine()
+
+	for _, size := range [][2]int{{100, 30}, {31, 77}, {64, 48}} {
+		width, height := size[0], size[1]
+
+		renderer.Resize(width, height)
+		renderer.Draw(scene, camera)
+
+		fb := renderer.fb
+		if fb.Width != width || fb.Height != height || len(fb.Pixels) != width*height || len(fb.ObjectIDs) != width*height {
+			t.Fatalf("frame buffer is %dx%d with %d pixels, want %dx%d", fb.Width, fb.Height, len(fb.Pixels), width, height)
+		}
+
+		// Tiles must cover the whole frame without overlapping
+		area := 0
+		for i := range renderer.numTiles {
+			start, end := renderer.gridBounds[i][0], renderer.gridBounds[i][1]
+			area += int(max(end.X-start.X, 0) * max(end.Y-start.Y, 0))
+		}
+
+		if area != width*height {
+			t.Errorf("%dx%d: tiles cover %d pixels, want %d", width, height, area, width*height)
+		}
+
+		// The object is in the center of the frame whatever the aspect ratio is
+		result, ok := renderer.Pick(width/2, height/2)
+		if !ok {
+			t.Errorf("%dx%d: nothing picked in the center", width, height)
+		} else if p := result.Position; abs(p.X) > 0.1 || abs(p.Y) > 0.1 || abs(p.Z-1) > 0.05 {
+			t.Errorf("%dx%d: picked position %v, want the center of the front face", width, height, p)
+		}
+	}
+
+	if n := runtime.NumGoroutine(); n != goroutines {
+		t.Errorf("%d goroutines after resizing, want %d", n, goroutines)
+	}
+}
+
+// TestRenderer_SSAO compares the ambient occlusion of the forward and the deferred shading.
+// Both darken the ambient light before the colors are clamped, so the bright surfaces stay
+// saturated unless the occlusion is strong.
+func TestRenderer_SSAO(t *testing.T) {
+	// Gray surfaces lit to 1.2 of the full intensity
+	material := NewMaterial("gray", NewColorTexture(color.RGBA{128, 128, 128, 255}))
+
+	scene := &Scene{
+		Objects: []*Object{setMaterial(NewObject(newRoomMesh(2, 4)), material)},
+		Lights:  []*Light{NewAmbientLight(color.RGBA{255, 255, 255, 255}, 2.4)},
+	}
+
+	camera := NewCamera(Vec3{0, 0, 0.9}, Vec3{0, 0, -1})
+
+	// Average brightness of the frame
+	draw := func(ssao, deferred, toon bool) float32 {
+		renderer := newTestRenderer(64, 48)
+		renderer.BackfaceCulling = false
+		renderer.SSAO = ssao
+		renderer.Deferred = deferred
+		renderer.Toon = toon
+		renderer.GammaCorrection = false
+		renderer.Draw(scene, camera)
+
+		sum := 0
+		for _, c := range renderer.fb.Pixels {
+			sum += int(c.R)
+		}
+
+		return float32(sum) / float32(len(renderer.fb.Pixels))
+	}
+
+	var (
+		plain    = draw(false, false, false)
+		forward  = draw(true, false, false)
+		deferred = draw(true, true, false)
+	)
+
+	if forward >= plain {
+		t.Errorf("forward shading is not occluded: %g, was %g", forward, plain)
+	}
+
+	if abs(forward-deferred) > 1 {
+		t.Errorf("forward shading brightness is %g, want %g as in the deferred shading", forward, deferred)
+	}
+
+	// Toon shading is not occluded in either path, even where the light is not saturated
+	scene.Lights = []*Light{NewAmbientLight(color.RGBA{255, 255, 255, 255}, 1)}
+
+	for _, deferred := range []bool{false, true} {
+		if got, want := draw(true, deferred, true), draw(false, deferred, true); got != want {
+			t.Errorf("toon shading brightness with SSAO is %g, want %g (deferred: %t)", got, want, deferred)
+		}
+	}
+}
+
+// TestRenderer_DotGrid checks that the dot grid is drawn behind the geometry without
+// running the post effects.
+func TestRenderer_DotGrid(t *testing.T) {
+	scene := &Scene{
+		Objects: []*Object{newQuadObject(Vec3{}, Vec3{0, 0, 1}, 1)},
+		Lights:  DefaultLights(),
+	}
+
+	renderer := newTestRenderer(64, 48)
+	renderer.Draw(scene, NewCamera(Vec3{0, 0, 3}, Vec3{0, 0, -1}))
+
+	if len(renderer.effects) != 0 {
+		t.Errorf("%d post effects, want none", len(renderer.effects))
+	}
+
+	tests := map[string]struct {
+		x, y int
+		want color.RGBA
+	}{
+		"dot":        {x: 10, y: 10, want: dotGridColor},
+		"background": {x: 15, y: 10, want: backgroundColor},
+		"frame edge": {x: 0, y: 0, want: backgroundColor},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := renderer.fb.Pixels[tt.y*64+tt.x]; got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The dot in the center is covered by the square
+	if c := renderer.fb.Pixels[20*64+30]; c == dotGridColor || c == backgroundColor {
+		t.Errorf("center pixel is %v, want the square", c)
+	}
+}
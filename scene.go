@@ -14,23 +14,98 @@ type SceneMeshData struct {
 	ObjFile      string  `json:"objFile"`
 	Texture      string  `json:"texture"`
 	TextureScale float32 `json:"textureScale"`
+	NormalMap    string  `json:"normalMap"`
+	Reflectivity float32 `json:"reflectivity"`
+	CullMode     string  `json:"cullMode"` // back, front or none, back if omitted
+	Winding      string  `json:"winding"`  // ccw or cw, ccw if omitted
 }
 
 type SceneObjectData struct {
-	MeshID   string     `json:"meshID"`
-	Position [3]float32 `json:"position"`
-	Rotation [3]float32 `json:"rotation"`
-	Scale    [3]float32 `json:"scale"`
+	MeshID         string     `json:"meshID"`
+	Position       [3]float32 `json:"position"`
+	Rotation       [3]float32 `json:"rotation"`
+	Scale          [3]float32 `json:"scale"`
+	CastShadows    *bool      `json:"castShadows"`    // true if omitted
+	ReceiveShadows *bool      `json:"receiveShadows"` // true if omitted
+	DepthBias      float32    `json:"depthBias"`      // see Object.DepthBias
+	SlopeDepthBias float32    `json:"slopeDepthBias"`
+}
+
+type SceneLightData struct {
+	Type        string     `json:"type"`      // ambient, directional, point or spot
+	Color       *[3]uint8  `json:"color"`     // white if omitted
+	Intensity   *float32   `json:"intensity"` // 1 if omitted
+	Position    [3]float32 `json:"position"`
+	Direction   [3]float32 `json:"direction"`
+	Attenuation [3]float32 `json:"attenuation"` // constant, linear, quadratic
+	InnerAngle  float32    `json:"innerAngle"`  // degrees
+	OuterAngle  float32    `json:"outerAngle"`  // degrees
+	CastShadows bool       `json:"castShadows"`
+	ShadowBias  float32    `json:"shadowBias"`
+	ShadowPCF   int        `json:"shadowPCF"`
+}
+
+// SceneEnvironmentData sets either a cubemap or an equirectangular panorama.
+type SceneEnvironmentData struct {
+	Cubemap  []string `json:"cubemap"` // +X, -X, +Y, -Y, +Z, -Z
+	Panorama string   `json:"panorama"`
+}
+
+// SceneFogData overrides the default fog settings. Fields that are omitted keep their defaults.
+type SceneFogData struct {
+	Mode    string   `json:"mode"` // none, linear, exp or exp2
+	Color   [3]uint8 `json:"color"`
+	Start   float32  `json:"start"`
+	End     float32  `json:"end"`
+	Density float32  `json:"density"`
+}
+
+// ScenePostEffectData configures a post-processing effect. Parameters that are
+// omitted or zero use the effect defaults.
+type ScenePostEffectData struct {
+	Type      string   `json:"type"` // vignette, bloom, lut, sharpen, chromaticAberration or outline
+	Strength  float32  `json:"strength"`
+	Radius    float32  `json:"radius"`
+	Threshold float32  `json:"threshold"` // bloom
+	Intensity float32  `json:"intensity"` // bloom
+	File      string   `json:"file"`      // lut
+	Color     [3]uint8 `json:"color"`     // outline
+	Width     int      `json:"width"`     // outline
+}
+
+// SceneCameraData declares a named viewpoint. The camera looks either along the direction
+// or at the target. Projection parameters that are omitted or zero use the camera defaults.
+type SceneCameraData struct {
+	Name        string      `json:"name"`
+	Position    [3]float32  `json:"position"`
+	Direction   [3]float32  `json:"direction"`
+	Target      *[3]float32 `json:"target"`     // instead of the direction
+	Up          [3]float32  `json:"up"`         // +Y if omitted
+	Projection  string      `json:"projection"` // perspective or orthographic
+	FOV         float32     `json:"fov"`        // degrees, vertical
+	Near        float32     `json:"near"`
+	Far         float32     `json:"far"`
+	OrthoExtent float32     `json:"orthoExtent"`
 }
 
 type SceneData struct {
-	Name    string            `json:"name"`
-	Meshes  []SceneMeshData   `json:"meshes"`
-	Objects []SceneObjectData `json:"objects"`
+	Name        string                `json:"name"`
+	Meshes      []SceneMeshData       `json:"meshes"`
+	Objects     []SceneObjectData     `json:"objects"`
+	Lights      []SceneLightData      `json:"lights"`
+	Environment *SceneEnvironmentData `json:"environment"`
+	Fog         *SceneFogData         `json:"fog"`
+	PostEffects []ScenePostEffectData `json:"postEffects"`
+	Cameras     []SceneCameraData     `json:"cameras"`
 }
 
 type Scene struct {
-	Objects []*Object
+	Objects     []*Object
+	Lights      []*Light
+	Environment *Environment // optional
+	Fog         Fog
+	PostEffects []PostEffect // applied in order
+	Cameras     []*Camera    // optional viewpoints, the first one is the initial
 }
 
 func (s *Scene) NumObjects() int {
@@ -53,6 +128,210 @@ func (s *Scene) NumTriangles() (n int) {
 	return n
 }
 
+func newSceneLight(data *SceneLightData) (*Light, error) {
+	var (
+		c          = color.RGBA{255, 255, 255, 255}
+		intensity  = float32(1)
+		position   = Vec3FromArray(data.Position)
+		direction  = Vec3FromArray(data.Direction)
+		innerAngle = data.InnerAngle * (pi32 / 180)
+		outerAngle = data.OuterAngle * (pi32 / 180)
+		light      *Light
+	)
+
+	if data.Color != nil {
+		c = color.RGBA{data.Color[0], data.Color[1], data.Color[2], 255}
+	}
+
+	if data.Intensity != nil {
+		intensity = *data.Intensity
+	}
+
+	if intensity < 0 {
+		return nil, fmt.Errorf("%s light intensity must not be negative", data.Type)
+	}
+
+	switch data.Type {
+	case "ambient":
+		light = NewAmbientLight(c, intensity)
+	case "directional":
+		light = NewDirectionalLight(direction, c, intensity)
+	case "point":
+		light = NewPointLight(position, c, intensity)
+	case "spot":
+		light = NewSpotLight(position, direction, innerAngle, outerAngle, c, intensity)
+	default:
+		return nil, fmt.Errorf("unknown light type: %s", data.Type)
+	}
+
+	if (light.Type == LightTypeDirectional || light.Type == LightTypeSpot) && direction == (Vec3{}) {
+		return nil, fmt.Errorf("%s light has no direction", data.Type)
+	}
+
+	if data.CastShadows && !light.CanCastShadows() {
+		return nil, fmt.Errorf("%s light cannot cast shadows", data.Type)
+	}
+
+	light.CastShadows = data.CastShadows
+	light.ShadowPCF = data.ShadowPCF
+
+	if data.ShadowBias != 0 {
+		light.ShadowBias = data.ShadowBias
+	}
+
+	if data.Attenuation != [3]float32{0, 0, 0} {
+		light.Constant = data.Attenuation[0]
+		light.Linear = data.Attenuation[1]
+		light.Quadratic = data.Attenuation[2]
+	}
+
+	return light, nil
+}
+
+func loadSceneEnvironment(rootDir string, data *SceneEnvironmentData) (*Environment, error) {
+	switch {
+	case len(data.Cubemap) != 0 && data.Panorama != "":
+		return nil, fmt.Errorf("both cubemap and panorama are set")
+	case len(data.Cubemap) != 0:
+		if len(data.Cubemap) != 6 {
+			return nil, fmt.Errorf("cubemap must have 6 faces, got %d", len(data.Cubemap))
+		}
+
+		var filenames [6]string
+		for i, filename := range data.Cubemap {
+			filenames[i] = path.Join(rootDir, filename)
+		}
+
+		return LoadCubemapFiles(filenames)
+	case data.Panorama != "":
+		return LoadPanoramaFile(path.Join(rootDir, data.Panorama))
+	default:
+		return nil, fmt.Errorf("neither cubemap nor panorama is set")
+	}
+}
+
+func newSceneFog(data *SceneFogData) (Fog, error) {
+	fog := DefaultFog()
+
+	mode, err := ParseFogMode(data.Mode)
+	if err != nil {
+		return fog, err
+	}
+
+	fog.Mode = mode
+
+	if data.Color != [3]uint8{0, 0, 0} {
+		fog.Color = color.RGBA{data.Color[0], data.Color[1], data.Color[2], 255}
+	}
+
+	if data.Start != 0 || data.End != 0 {
+		fog.Start, fog.End = data.Start, data.End
+	}
+
+	if data.Density != 0 {
+		fog.Density = data.Density
+	}
+
+	if fog.Mode == FogModeLinear && fog.End <= fog.Start {
+		return fog, fmt.Errorf("fog end must be greater than start")
+	}
+
+	return fog, nil
+}
+
+func newScenePostEffect(rootDir string, data *ScenePostEffectData) (PostEffect, error) {
+	orDefault := func(v, def float32) float32 {
+		if v == 0 {
+			return def
+		}
+
+		return v
+	}
+
+	switch data.Type {
+	case "vignette":
+		return NewVignetteEffect(orDefault(data.Strength, 0.5), orDefault(data.Radius, 0.5)), nil
+	case "bloom":
+		radius := int(orDefault(data.Radius, 4))
+		return NewBloomEffect(orDefault(data.Threshold, 0.8), orDefault(data.Intensity, 0.6), radius), nil
+	case "lut":
+		if data.File == "" {
+			return nil, fmt.Errorf("lut effect has no file")
+		}
+
+		lut, err := LoadColorLUTFile(path.Join(rootDir, data.File))
+		if err != nil {
+			return nil, err
+		}
+
+		lut.Strength = orDefault(data.Strength, 1)
+
+		return lut, nil
+	case "sharpen":
+		return NewSharpenEffect(orDefault(data.Strength, 0.3)), nil
+	case "chromaticAberration":
+		return NewChromaticAberrationEffect(orDefault(data.Strength, 2)), nil
+	case "outline":
+		c := color.RGBA{data.Color[0], data.Color[1], data.Color[2], 255}
+		return NewOutlineEffect(c, max(data.Width, 1)), nil
+	default:
+		return nil, fmt.Errorf("unknown post effect type: %s", data.Type)
+	}
+}
+
+func newSceneCamera(data *SceneCameraData) (*Camera, error) {
+	var (
+		position  = Vec3FromArray(data.Position)
+		direction = Vec3FromArray(data.Direction)
+	)
+
+	if data.Target != nil {
+		if direction != (Vec3{}) {
+			return nil, fmt.Errorf("both direction and target are set")
+		}
+
+		direction = Vec3FromArray(*data.Target).Sub(position)
+	}
+
+	camera := NewCamera(position, direction)
+	camera.Name = data.Name
+
+	if data.Up != [3]float32{0, 0, 0} {
+		camera.Up = Vec3FromArray(data.Up)
+	}
+
+	if data.Projection != "" {
+		projection, err := ParseProjection(data.Projection)
+		if err != nil {
+			return nil, err
+		}
+
+		camera.Projection = projection
+	}
+
+	if data.FOV != 0 {
+		camera.FOV = data.FOV * (pi32 / 180)
+	}
+
+	if data.Near != 0 {
+		camera.Near = data.Near
+	}
+
+	if data.Far != 0 {
+		camera.Far = data.Far
+	}
+
+	if data.OrthoExtent != 0 {
+		camera.OrthoExtent = data.OrthoExtent
+	}
+
+	if err := camera.Validate(); err != nil {
+		return nil, err
+	}
+
+	return camera, nil
+}
+
 func LoadSceneFile(filename string) (*Scene, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -77,6 +356,7 @@ func LoadSceneFile(filename string) (*Scene, error) {
 		rootDir = path.Dir(filename)
 		meshes  = make(map[string]*Mesh)
 		objects []*Object
+		lights  []*Light
 	)
 
 	for _, meshData := range sceneData.Meshes {
@@ -87,23 +367,83 @@ func LoadSceneFile(filename string) (*Scene, error) {
 
 		mesh := loadedMeshes[0]
 
+		var (
+			texture, normalMap *Texture
+			cullMode           CullMode
+			winding            Winding
+		)
+
+		if meshData.CullMode != "" {
+			if cullMode, err = ParseCullMode(meshData.CullMode); err != nil {
+				return nil, fmt.Errorf("failed to load mesh '%s': %w", meshData.ID, err)
+			}
+		}
+
+		if meshData.Winding != "" {
+			if winding, err = ParseWinding(meshData.Winding); err != nil {
+				return nil, fmt.Errorf("failed to load mesh '%s': %w", meshData.ID, err)
+			}
+		}
+
 		if meshData.Texture != "" {
-			texture, err := LoadTextureFile(path.Join(rootDir, meshData.Texture))
-			if err != nil {
+			if texture, err = LoadTextureFile(path.Join(rootDir, meshData.Texture)); err != nil {
 				return nil, fmt.Errorf("failed to load texture %s: %w", meshData.ID, err)
 			}
 
 			if meshData.TextureScale != 0 {
 				texture.SetScale(meshData.TextureScale)
 			}
+		}
 
-			for i := range mesh.Faces {
-				mesh.Faces[i].Texture = texture
+		if meshData.NormalMap != "" {
+			if normalMap, err = LoadTextureFile(path.Join(rootDir, meshData.NormalMap)); err != nil {
+				return nil, fmt.Errorf("failed to load normal map %s: %w", meshData.ID, err)
+			}
+
+			if meshData.TextureScale != 0 {
+				normalMap.SetScale(meshData.TextureScale)
 			}
-		} else {
-			for i := range mesh.Faces {
-				mesh.Faces[i].Texture = defaultTexture
+		}
+
+		// Faces keep the materials from the MTL library, the manifest only overrides
+		// the properties it sets. Faces without a material share the default one.
+		materials := make(map[*Material]*Material)
+
+		for i := range mesh.Faces {
+			loaded := mesh.Faces[i].Material
+
+			material, ok := materials[loaded]
+			if !ok {
+				if loaded != nil {
+					material = loaded
+				} else {
+					material = NewMaterial(meshData.ID, defaultTexture)
+				}
+
+				if meshData.Reflectivity != 0 {
+					material.Reflectivity = min(max(meshData.Reflectivity, 0), 1)
+				}
+
+				if meshData.CullMode != "" {
+					material.CullMode = cullMode
+				}
+
+				if meshData.Winding != "" {
+					material.Winding = winding
+				}
+
+				if texture != nil {
+					material.Texture = texture
+				}
+
+				if normalMap != nil {
+					material.NormalMap = normalMap
+				}
+
+				materials[loaded] = material
 			}
+
+			mesh.Faces[i].Material = material
 		}
 
 		meshes[meshData.ID] = mesh
@@ -124,10 +464,83 @@ func LoadSceneFile(filename string) (*Scene, error) {
 		obj.Rotation = Vec3FromArray(objData.Rotation).ToRadians()
 		obj.Translation = Vec3FromArray(objData.Position)
 
+		if objData.CastShadows != nil {
+			obj.CastShadows = *objData.CastShadows
+		}
+
+		if objData.ReceiveShadows != nil {
+			obj.ReceiveShadows = *objData.ReceiveShadows
+		}
+
+		obj.DepthBias = objData.DepthBias
+		obj.SlopeDepthBias = objData.SlopeDepthBias
+
 		objects = append(objects, obj)
 	}
 
+	for i := range sceneData.Lights {
+		light, err := newSceneLight(&sceneData.Lights[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load light #%d: %w", i, err)
+		}
+
+		lights = append(lights, light)
+	}
+
+	if len(lights) == 0 {
+		lights = DefaultLights()
+	}
+
+	var environment *Environment
+
+	if sceneData.Environment != nil {
+		environment, err = loadSceneEnvironment(rootDir, sceneData.Environment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load environment: %w", err)
+		}
+	}
+
+	fog := DefaultFog()
+
+	if sceneData.Fog != nil {
+		fog, err = newSceneFog(sceneData.Fog)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load fog: %w", err)
+		}
+	}
+
+	postEffects := make([]PostEffect, 0, len(sceneData.PostEffects))
+
+	for i := range sceneData.PostEffects {
+		effect, err := newScenePostEffect(rootDir, &sceneData.PostEffects[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load post effect %d: %w", i, err)
+		}
+
+		postEffects = append(postEffects, effect)
+	}
+
+	cameras := make([]*Camera, 0, len(sceneData.Cameras))
+
+	for i := range sceneData.Cameras {
+		camera, err := newSceneCamera(&sceneData.Cameras[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load camera %d: %w", i, err)
+		}
+
+		if camera.Name == "" {
+			camera.Name = fmt.Sprintf("camera %d", i+1)
+		}
+
+		cameras = append(cameras, camera)
+	}
+
 	return &Scene{
-		Objects: objects,
+		Objects:     objects,
+		Lights:      lights,
+		Environment: environment,
+		Fog:         fog,
+		PostEffects: postEffects,
+		Cameras:     cameras,
 	}, err
 }
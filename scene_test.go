@@ -0,0 +1,101 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeColorImage writes a single color PNG image to the file.
+func writeColorImage(t *testing.T, filename string, c color.RGBA) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSceneFile_Materials(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	tests := map[string]struct {
+		mesh      string
+		texture   color.RGBA
+		normalMap bool
+		cullMode  CullMode
+	}{
+		"loaded material": {
+			mesh:      `{"id": "triangle", "objFile": "triangle.obj"}`,
+			texture:   red,
+			normalMap: true,
+			cullMode:  CullBack,
+		},
+		"overridden cull mode": {
+			mesh:      `{"id": "triangle", "objFile": "triangle.obj", "cullMode": "none"}`,
+			texture:   red,
+			normalMap: true,
+			cullMode:  CullNone,
+		},
+		"overridden texture": {
+			mesh:      `{"id": "triangle", "objFile": "triangle.obj", "texture": "blue.png"}`,
+			texture:   blue,
+			normalMap: true,
+			cullMode:  CullBack,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := writeSceneFiles(t, map[string]string{
+				"triangle.obj": testSceneTriangle,
+				"triangle.mtl": "newmtl red\nmap_Kd red.png\nmap_Bump normal.png\n",
+				"scene.json":   `{"meshes": [` + tt.mesh + `], "objects": [{"meshID": "triangle", "scale": [1, 1, 1]}]}`,
+			})
+
+			writeColorImage(t, path.Join(dir, "red.png"), red)
+			writeColorImage(t, path.Join(dir, "blue.png"), blue)
+			writeColorImage(t, path.Join(dir, "normal.png"), color.RGBA{128, 128, 255, 255})
+
+			scene, err := LoadSceneFile(path.Join(dir, "scene.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			material := scene.Objects[0].Mesh.Faces[0].Material
+
+			if material.Name != "red" {
+				t.Errorf("material is %q, want the loaded one", material.Name)
+			}
+
+			if got := material.Texture.Sample(0.5, 0.5); got != tt.texture {
+				t.Errorf("texture color is %v, want %v", got, tt.texture)
+			}
+
+			if (material.NormalMap != nil) != tt.normalMap {
+				t.Errorf("normal map is %v, want %v", material.NormalMap != nil, tt.normalMap)
+			}
+
+			if material.CullMode != tt.cullMode {
+				t.Errorf("cull mode is %v, want %v", material.CullMode, tt.cullMode)
+			}
+		})
+	}
+}
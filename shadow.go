@@ -0,0 +1,164 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	shadowMapSize  = 1024
+	shadowMapZNear = 0.05
+)
+
+// ShadowMap is a depth buffer rendered from the light’s point of view. Pixels that are
+// further from the light than the stored depth are in shadow. The light is projected like
+// a camera with the standard depth, see DepthStandard, so the closest depth is the smallest.
+type ShadowMap struct {
+	depth       *FrameBuffer
+	matrix      Matrix // world space to shadow map space
+	clip        Matrix // world space to clip space
+	screen      Matrix // normalized device coordinates to shadow map space
+	frustum     *Frustum
+	perspective bool
+
+	numTiles      uint
+	tileBounds    [maxTiles][2]Vec2
+	tileTriangles [maxTiles][][3]Vec4
+	tileLocks     [maxTiles]sync.Mutex
+}
+
+func NewShadowMap(size int, numTiles uint) *ShadowMap {
+	sm := &ShadowMap{
+		depth:    NewDepthBuffer(size, size),
+		frustum:  NewFrustum(),
+		numTiles: numTiles,
+	}
+
+	sm.frustum.SetGuardBand(guardBandSize)
+
+	for i := uint(0); i < numTiles; i++ {
+		start, end := calculateTileBoundaries(i, numTiles, size, size)
+		sm.tileBounds[i] = [2]Vec2{start, end}
+	}
+
+	return sm
+}
+
+// Update positions the shadow map camera at the light. Directional lights use an orthographic
+// projection covering the whole scene bounding sphere, spot lights use a perspective projection
+// covering the light cone.
+func (sm *ShadowMap) Update(light *Light, sceneCenter Vec3, sceneRadius float32) {
+	var (
+		eye        Vec3
+		direction  = light.Direction.Normalize()
+		projection Matrix
+	)
+
+	switch light.Type {
+	case LightTypeDirectional:
+		eye = sceneCenter.Sub(direction.Multiply(sceneRadius))
+		projection = NewOrthographicCameraMatrix(sceneRadius, 1, 0, 2*sceneRadius, false)
+		sm.perspective = false
+	case LightTypeSpot:
+		eye = light.Position
+		fov := min(2*max(light.OuterAngle, light.InnerAngle), pi32*0.9)
+		zFar := eye.Sub(sceneCenter).Length() + sceneRadius
+		projection = NewPerspectiveCameraMatrix(fov, 1, shadowMapZNear, zFar, false)
+		sm.perspective = true
+	default:
+		panic("light type cannot cast shadows")
+	}
+
+	up := Vec3{0, 1, 0}
+	if abs(direction.Y) > 0.99 {
+		up = Vec3{0, 0, 1}
+	}
+
+	viewMatrix := NewViewMatrix(eye, direction, up)
+
+	sm.clip = projection.Multiply(viewMatrix)
+	sm.screen = NewScreenMatrix(sm.depth.Width, sm.depth.Height)
+	sm.matrix = sm.screen.Multiply(sm.clip)
+	sm.depth.ClearDepth(math.MaxFloat32)
+
+	for i := uint(0); i < sm.numTiles; i++ {
+		sm.tileTriangles[i] = sm.tileTriangles[i][:0]
+	}
+}
+
+// Visibility tells how much of the light reaches the world space point: 1 if the point is lit,
+// 0 if it is in shadow. With percentage-closer filtering enabled (pcf > 0), the depth is compared
+// against (2*pcf+1)² neighbouring texels giving soft shadow edges.
+func (sm *ShadowMap) Visibility(point Vec3, pcf int) float32 {
+	q := point.ToVec4()
+	matrixMultiplyVec4Inplace(&sm.matrix, &q)
+
+	// Points behind the spot light cannot be shadowed by anything, W is the depth
+	if sm.perspective && q.W < shadowMapZNear {
+		return 1
+	}
+
+	var (
+		size  = sm.depth.Width
+		depth = q.Z / q.W
+		x     = int(q.X / q.W)
+		y     = int(q.Y / q.W)
+	)
+
+	// Everything outside the shadow map is lit
+	if x < 0 || y < 0 || x >= size || y >= size {
+		return 1
+	}
+
+	if pcf <= 0 {
+		if depth <= sm.depth.ZBuffer[y*size+x] {
+			return 1
+		}
+
+		return 0
+	}
+
+	lit, total := 0, 0
+
+	for sy := max(y-pcf, 0); sy <= min(y+pcf, size-1); sy++ {
+		for sx := max(x-pcf, 0); sx <= min(x+pcf, size-1); sx++ {
+			if depth <= sm.depth.ZBuffer[sy*size+sx] {
+				lit++
+			}
+			total++
+		}
+	}
+
+	return float32(lit) / float32(total)
+}
+
+// sceneBounds returns the bounding sphere of all objects in world space.
+func sceneBounds(objects []*Object) (center Vec3, radius float32) {
+	if len(objects) == 0 {
+		return Vec3{}, 1
+	}
+
+	var minV, maxV Vec3
+
+	for i, object := range objects {
+		worldMatrix := NewWorldMatrix(object.Scale, object.Rotation, object.Translation)
+
+		bbox := object.BoundingBox
+		matrixMultiplyVec4Batch(&worldMatrix, bbox[:])
+
+		for j, v := range bbox {
+			if i == 0 && j == 0 {
+				minV, maxV = v.ToVec3(), v.ToVec3()
+				continue
+			}
+
+			minV = Vec3{min(minV.X, v.X), min(minV.Y, v.Y), min(minV.Z, v.Z)}
+			maxV = Vec3{max(maxV.X, v.X), max(maxV.Y, v.Y), max(maxV.Z, v.Z)}
+		}
+	}
+
+	center = minV.Add(maxV).Divide(2)
+	radius = max(maxV.Sub(center).Length(), 0.001)
+
+	return center, radius
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"image/color"
+	"testing"
+)
+
+// newShadowScene returns the ground with a unit square above it at the height 1.
+func newShadowScene(offset Vec3) []*Object {
+	up := Vec3{0, 1, 0}
+	occluder := newQuadObject(Vec3{0, 1, 0}, up, 1)
+	occluder.Translation = offset
+	return []*Object{newQuadObject(Vec3{}, up, 20), occluder}
+}
+
+// drawShadowMap draws the scene lit by the light and returns the shadow map of the light.
+func drawShadowMap(t *testing.T, objects []*Object, light *Light) *ShadowMap {
+	t.Helper()
+
+	light.CastShadows = true
+
+	scene := &Scene{
+		Objects: objects,
+		Lights:  []*Light{light},
+	}
+
+	renderer := NewRenderer(NewFrameBuffer(64, 48))
+	renderer.Draw(scene, NewCamera(Vec3{0, 10, 10}, Vec3{0, -1, -1}))
+
+	if len(renderer.shadowMaps) == 0 {
+		t.Fatal("no shadow map was drawn")
+	}
+
+	return renderer.shadowMaps[0]
+}
+
+func TestShadowMap_Visibility(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+
+	tests := map[string]struct {
+		light *Light
+		edge  float32 // half size of the shadow on the ground
+	}{
+		"directional": {
+			light: NewDirectionalLight(Vec3{0, -1, 0}, white, 1),
+			edge:  0.5,
+		},
+		"spot": {
+			// The square is 2 units below the light, and the ground is 3 units
+			light: NewSpotLight(Vec3{0, 3, 0}, Vec3{0, -1, 0}, pi32/6, pi32/4, white, 1),
+			edge:  0.75,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sm := drawShadowMap(t, newShadowScene(Vec3{}), tt.light)
+
+			for _, x := range []float32{-1.5, -1, -0.5, 0, 0.5, 1, 1.5} {
+				for _, z := range []float32{-1.5, -1, -0.5, 0, 0.5, 1, 1.5} {
+					// The boundary is left out, as it depends on the rasterization
+					d := max(abs(x), abs(z))
+					if abs(d-tt.edge) < 0.1 {
+						continue
+					}
+
+					want := float32(1)
+					if d < tt.edge {
+						want = 0
+					}
+
+					// Slightly above the ground, so that it does not shadow itself
+					if got := sm.Visibility(Vec3{x, 0.01, z}, 0); got != want {
+						t.Errorf("visibility at %g, %g is %g, want %g", x, z, got, want)
+					}
+				}
+			}
+
+			// Neither the occluder itself, nor the points in front of it are shadowed
+			for _, p := range []Vec3{{0, 1.01, 0}, {0.2, 1.5, -0.2}} {
+				if got := sm.Visibility(p, 0); got != 1 {
+					t.Errorf("visibility at %v is %g, want 1", p, got)
+				}
+			}
+		})
+	}
+}
+
+// TestShadowMap_LightView checks that the shadow map is the depth of the scene as seen by
+// a camera placed at the spot light: the occluder covers the same pixels in both. It is
+// off the center, so that a mirrored projection would not match.
+func TestShadowMap_LightView(t *testing.T) {
+	var (
+		white = color.RGBA{255, 255, 255, 255}
+		red   = color.RGBA{255, 0, 0, 255}
+	)
+
+	objects := newShadowScene(Vec3{0.4, 0, 0.2})
+	setMaterial(objects[0], NewMaterial("ground", NewColorTexture(white)))
+	setMaterial(objects[1], NewMaterial("occluder", NewColorTexture(red)))
+
+	light := NewSpotLight(Vec3{0, 3, 0}, Vec3{0, -1, 0}, pi32/12, pi32/8, white, 1)
+	sm := drawShadowMap(t, objects, light)
+
+	const size = 32
+
+	scene := &Scene{
+		Objects: objects,
+		Lights:  []*Light{NewAmbientLight(white, 1)},
+	}
+
+	// See ShadowMap.Update for the orientation of the light
+	renderer := newTestRenderer(size, size)
+	renderer.BackfaceCulling = false
+	camera := NewCamera(light.Position, light.Direction)
+	camera.Up = Vec3{0, 0, 1}
+	camera.FOV = 2 * light.OuterAngle
+	renderer.Draw(scene, camera)
+
+	// Depth of the plane between the occluder and the ground, the same for all texels
+	q := Vec4{0, 0.5, 0, 1}
+	matrixMultiplyVec4Inplace(&sm.matrix, &q)
+	threshold := q.Z / q.W
+
+	scale := sm.depth.Width / size
+
+	occluderAt := func(x, y int) bool {
+		x, y = min(max(x, 0), size-1), min(max(y, 0), size-1)
+		return renderer.fb.Pixels[y*size+x].G < 128 // red, the ground is white
+	}
+
+	// The rasterizers snap the vertices differently, the edges may be off by a pixel
+	nearEdge := func(x, y int) bool {
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if occluderAt(x+dx, y+dy) != occluderAt(x, y) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for y := range size {
+		for x := range size {
+			var (
+				occluder = occluderAt(x, y)
+				texel    = (y*scale+scale/2)*sm.depth.Width + x*scale + scale/2
+				depth    = sm.depth.ZBuffer[texel]
+			)
+
+			if nearEdge(x, y) {
+				continue
+			}
+
+			if occluder != (depth < threshold) {
+				t.Errorf("pixel %d, %d: occluder visible is %t, depth in the shadow map is %g, occluder below %g",
+					x, y, occluder, depth, threshold)
+			}
+		}
+	}
+}
+
+// TestShadowMap_NearPlane checks that a caster reaching behind the spot light still casts
+// its shadow: the wall next to the light is cut at the near plane of the light.
+func TestShadowMap_NearPlane(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+
+	// From 0.5 to 5 units high, while the light is at the height 3
+	wall := newQuadObject(Vec3{0.3, 2.75, 0}, Vec3{-1, 0, 0}, 4.5)
+	ground := newQuadObject(Vec3{}, Vec3{0, 1, 0}, 20)
+
+	light := NewSpotLight(Vec3{0, 3, 0}, Vec3{0, -1, 0}, pi32/4, pi32/3, white, 1)
+	sm := drawShadowMap(t, []*Object{ground, wall}, light)
+
+	tests := map[string]struct {
+		point Vec3
+		want  float32
+	}{
+		"behind the wall":       {point: Vec3{1, 0.01, 0}, want: 0},
+		"behind the wall, side": {point: Vec3{1.5, 0.01, -1}, want: 0},
+		"under the wall":        {point: Vec3{0.2, 0.01, 0}, want: 1},
+		"in front of the wall":  {point: Vec3{-1, 0.01, 0}, want: 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := sm.Visibility(tt.point, 0); got != tt.want {
+				t.Errorf("visibility at %v is %g, want %g", tt.point, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"image"
+	"math/rand/v2"
+)
+
+const (
+	ssaoKernelSize = 16
+	ssaoNoiseSize  = 4
+	ssaoBias       = 0.005 // relative to the depth, avoids self-occlusion on flat surfaces
+)
+
+var (
+	// Sample offsets in the tangent space hemisphere, denser closer to the center.
+	ssaoKernel [ssaoKernelSize]Vec3
+
+	// Random rotations of the kernel around the normal, tiled across the screen. Noise
+	// trades banding for a high-frequency pattern that is removed by the blur.
+	ssaoNoise [ssaoNoiseSize * ssaoNoiseSize]Vec3
+)
+
+func init() {
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	for i := range ssaoKernel {
+		sample := Vec3{
+			X: rnd.Float32()*2 - 1,
+			Y: rnd.Float32()*2 - 1,
+			Z: rnd.Float32(),
+		}.Normalize()
+
+		scale := float32(i) / ssaoKernelSize
+		scale = 0.1 + 0.9*scale*scale
+
+		ssaoKernel[i] = sample.Multiply(rnd.Float32() * scale)
+	}
+
+	for i := range ssaoNoise {
+		ssaoNoise[i] = Vec3{
+			X: rnd.Float32()*2 - 1,
+			Y: rnd.Float32()*2 - 1,
+		}
+	}
+}
+
+// positionAt returns the world space position of the pixel relative to the camera.
+func (r *Renderer) positionAt(x, y int) (Vec3, bool) {
+	zRec := r.fb.ZBuffer[y*r.fb.Width+x]
+	if zRec <= 0 {
+		return Vec3{}, false
+	}
+
+	return r.rays.Position(x, y, zRec), true
+}
+
+// normalFromDepth reconstructs the surface normal from the positions of the neighbouring
+// pixels. The neighbour closest in depth is used on each axis to keep the object edges sharp.
+func (r *Renderer) normalFromDepth(x, y int, p Vec3) Vec3 {
+	closest := func(x0, y0, x1, y1 int) Vec3 {
+		var (
+			d0, d1   Vec3
+			ok0, ok1 bool
+		)
+
+		// Neighbouring viewports are seen by other cameras
+		if x0 >= r.scissor.Min.X && y0 >= r.scissor.Min.Y {
+			d0, ok0 = r.positionAt(x0, y0)
+		}
+
+		if x1 < r.scissor.Max.X && y1 < r.scissor.Max.Y {
+			d1, ok1 = r.positionAt(x1, y1)
+		}
+
+		switch {
+		case ok0 && (!ok1 || d0.Sub(p).Length() < d1.Sub(p).Length()):
+			return p.Sub(d0)
+		case ok1:
+			return d1.Sub(p)
+		default:
+			return Vec3{}
+		}
+	}
+
+	dx := closest(x-1, y, x+1, y)
+	dy := closest(x, y-1, x, y+1)
+
+	// Screen Y goes down, so the cross product is flipped to face the camera
+	return dy.CrossProduct(dx).Normalize()
+}
+
+// computeOcclusion estimates how much of the hemisphere above each pixel of the tile is
+// blocked by the nearby geometry, by comparing the depth of the kernel samples with the
+// depth buffer. The result is 1 for unoccluded pixels and goes down to 0.
+func (r *Renderer) computeOcclusion(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		radius    = r.SSAORadius
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+			r.occlusionRaw[index] = 1
+
+			p, ok := r.positionAt(x, y)
+			if !ok {
+				continue
+			}
+
+			var normal Vec3
+			if r.geometryPass {
+				normal = r.gbuffer.Normals[index]
+			} else {
+				normal = r.normalFromDepth(x, y, p)
+			}
+
+			if normal == (Vec3{}) {
+				continue
+			}
+
+			// Tangent space basis with the random rotation around the normal
+			noise := ssaoNoise[(y%ssaoNoiseSize)*ssaoNoiseSize+x%ssaoNoiseSize]
+			tangent := noise.Sub(normal.Multiply(noise.DotProduct(normal)))
+			if tangent.Length() < 0.001 {
+				tangent = normal.CrossProduct(Vec3{0, 0, 1}).Add(normal.CrossProduct(Vec3{0, 1, 0}))
+			}
+
+			tangent = tangent.Normalize()
+			bitangent := normal.CrossProduct(tangent)
+
+			occluded := float32(0)
+			pointDepth := p.DotProduct(r.rays.forward)
+
+			for i := range ssaoKernel {
+				k := &ssaoKernel[i]
+				offset := tangent.Multiply(k.X).Add(bitangent.Multiply(k.Y)).Add(normal.Multiply(k.Z))
+				sample := p.Add(offset.Multiply(radius))
+
+				sx, sy, sampleDepth := r.rays.Project(sample)
+				ix, iy := int(sx+0.5), int(sy+0.5)
+
+				if sampleDepth <= 0 || !image.Pt(ix, iy).In(r.scissor) {
+					continue
+				}
+
+				zRec := r.fb.ZBuffer[iy*r.fb.Width+ix]
+				if zRec <= 0 {
+					continue
+				}
+
+				sceneDepth := r.rays.Depth(zRec)
+				if sceneDepth < sampleDepth-ssaoBias*pointDepth {
+					// Distant occluders fade out, so the objects do not darken the background
+					rangeCheck := min(radius/abs(pointDepth-sceneDepth), 1)
+					occluded += rangeCheck * rangeCheck * (3 - 2*rangeCheck)
+				}
+			}
+
+			r.occlusionRaw[index] = 1 - occluded/ssaoKernelSize
+		}
+	}
+}
+
+// blurOcclusion removes the noise pattern by averaging the occlusion of the neighbouring
+// pixels. Background pixels are excluded so that the occlusion does not bleed over the edges.
+func (r *Renderer) blurOcclusion(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		size      = r.SSAOBlur
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+
+			if size <= 0 || r.fb.ZBuffer[index] <= 0 {
+				r.occlusion[index] = r.occlusionRaw[index]
+				continue
+			}
+
+			sum, count := float32(0), 0
+
+			for by := max(y-size, r.scissor.Min.Y); by < min(y+size+1, r.scissor.Max.Y); by++ {
+				for bx := max(x-size, r.scissor.Min.X); bx < min(x+size+1, r.scissor.Max.X); bx++ {
+					i := by*r.fb.Width + bx
+					if r.fb.ZBuffer[i] > 0 {
+						sum += r.occlusionRaw[i]
+						count++
+					}
+				}
+			}
+
+			r.occlusion[index] = sum / float32(count)
+		}
+	}
+}
+
+// ambientOcclusion returns the factor the ambient light of the pixel is multiplied by.
+func (r *Renderer) ambientOcclusion(index int) float32 {
+	return 1 - r.SSAOStrength*(1-r.occlusion[index])
+}
+
+// applyOcclusion darkens the ambient light of the forward shaded pixels before the colors
+// are resolved. The ambient part of the pixel color is its albedo modulated by the ambient
+// lights, which do not depend on the surface orientation. Like in the lighting pass, unlit
+// pixels such as the clip plane caps are not occluded, and the reflections are not darkened.
+func (r *Renderer) applyOcclusion(tile uint) {
+	var (
+		tileStart = r.tileBounds[tile][0]
+		tileEnd   = r.tileBounds[tile][1]
+		g         = r.gbuffer
+	)
+
+	for y := int(tileStart.Y); y < int(tileEnd.Y); y++ {
+		for x := int(tileStart.X); x < int(tileEnd.X); x++ {
+			index := y*r.fb.Width + x
+
+			id := g.MaterialIDs[index]
+			if r.fb.ZBuffer[index] <= 0 || id&gbufferUnlit != 0 {
+				continue
+			}
+
+			occlusion := 1 - r.ambientOcclusion(index)
+			if occlusion <= 0 {
+				continue
+			}
+
+			if material := r.materials[id&gbufferMaterialMask]; material != nil {
+				occlusion *= 1 - material.Reflectivity
+			}
+
+			ambient := r.fb.decodeColor(g.Albedo[index]).Modulate(r.ambient)
+			r.fb.Colors[index] = r.fb.Colors[index].Add(ambient.Multiply(-occlusion))
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TileStats describes the work done for a single screen tile in the last frame.
+type TileStats struct {
+	X0, Y0, X1, Y1 int // tile bounds, the end is exclusive
+	Triangles      int
+	Fragments      int           // fragments that passed the depth test
+	RasterTime     time.Duration // rasterizing the triangles
+	ShadeTime      time.Duration // deferred lighting, ambient occlusion and tone mapping
+}
+
+// TileOverlay selects the tile metric shown over the frame as a heatmap.
+type TileOverlay int
+
+const (
+	TileOverlayNone TileOverlay = iota
+	TileOverlayTriangles
+	TileOverlayFragments
+	TileOverlayTime
+)
+
+func (o TileOverlay) String() string {
+	switch o {
+	case TileOverlayNone:
+		return "none"
+	case TileOverlayTriangles:
+		return "triangles"
+	case TileOverlayFragments:
+		return "fragments"
+	case TileOverlayTime:
+		return "time"
+	default:
+		return fmt.Sprintf("TileOverlay(%d)", int(o))
+	}
+}
+
+// Value returns the metric of the tile shown by the overlay.
+func (o TileOverlay) Value(s *TileStats) float32 {
+	switch o {
+	case TileOverlayTriangles:
+		return float32(s.Triangles)
+	case TileOverlayFragments:
+		return float32(s.Fragments)
+	case TileOverlayTime:
+		return float32((s.RasterTime + s.ShadeTime).Microseconds())
+	default:
+		return 0
+	}
+}
+
+// TileStats returns a copy of the per-tile statistics of the last frame.
+func (r *Renderer) TileStats() []TileStats {
+	return append([]TileStats(nil), r.tileStats[:r.numTiles]...)
+}
+
+// resetTileStats clears the counters before the frame is drawn.
+func (r *Renderer) resetTileStats() {
+	for i := range r.numTiles {
+		start, end := r.gridBounds[i][0], r.gridBounds[i][1]
+
+		r.tileStats[i] = TileStats{
+			X0: int(start.X),
+			Y0: int(start.Y),
+			X1: int(end.X),
+			Y1: int(end.Y),
+		}
+	}
+}
+
+// drawTileOverlay tints the tile with the heatmap color of its metric relative to the
+// busiest tile, and outlines the tile boundaries.
+func (r *Renderer) drawTileOverlay(tile uint) {
+	const opacity = 0.4
+
+	var (
+		stats = &r.tileStats[tile]
+		c     = heatmapColor(0)
+	)
+
+	if r.tileOverlayMax > 0 {
+		c = heatmapColor(r.TileOverlay.Value(stats) / r.tileOverlayMax)
+	}
+
+	for y := stats.Y0; y < stats.Y1; y++ {
+		for x := stats.X0; x < stats.X1; x++ {
+			index := y*r.fb.Width + x
+
+			if x == stats.X0 || y == stats.Y0 {
+				r.fb.Pixels[index] = c
+			} else {
+				r.fb.Pixels[index] = blendRGBA(r.fb.Pixels[index], c, opacity)
+			}
+		}
+	}
+}
+
+// drawTileOverlays draws the heatmap of the selected tile metric over the frame.
+func (r *Renderer) drawTileOverlays() {
+	r.tileOverlayMax = 0
+	for i := range r.numTiles {
+		r.tileOverlayMax = max(r.tileOverlayMax, r.TileOverlay.Value(&r.tileStats[i]))
+	}
+
+	r.runTiles(r.drawTileOverlay)
+}
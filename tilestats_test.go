@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRenderer_TileStats(t *testing.T) {
+	const width, height = 200, 120
+
+	var (
+		wall   = newQuadObject(Vec3{0, 0, -5}, Vec3{0, 0, 1}, 100)
+		square = newQuadObject(Vec3{0, 0, -1}, Vec3{0, 0, 1}, 0.2)
+	)
+
+	draw := func(t *testing.T, objects ...*Object) (fragments, pixels int) {
+		t.Helper()
+
+		renderer := newTestRenderer(width, height)
+		renderer.Draw(&Scene{Objects: objects, Lights: DefaultLights()}, NewCamera(Vec3{}, Vec3{0, 0, -1}))
+
+		covered := make([]int, width*height)
+
+		for _, s := range renderer.TileStats() {
+			for y := s.Y0; y < s.Y1; y++ {
+				for x := s.X0; x < s.X1; x++ {
+					covered[y*width+x]++
+				}
+			}
+
+			if s.Triangles == 0 && s.Fragments != 0 {
+				t.Errorf("tile %d, %d has %d fragments without triangles", s.X0, s.Y0, s.Fragments)
+			}
+
+			fragments += s.Fragments
+		}
+
+		for i, n := range covered {
+			if n != 1 {
+				t.Fatalf("pixel %d, %d is covered by %d tiles", i%width, i/width, n)
+			}
+		}
+
+		// The background has no depth
+		for _, zRec := range renderer.fb.ZBuffer {
+			if zRec > 0 {
+				pixels++
+			}
+		}
+
+		return fragments, pixels
+	}
+
+	if fragments, _ := draw(t); fragments != 0 {
+		t.Errorf("empty scene has %d fragments, want 0", fragments)
+	}
+
+	// One fragment per pixel without overlapping triangles
+	for name, object := range map[string]*Object{"wall": wall, "square": square} {
+		if fragments, pixels := draw(t, object); fragments == 0 || fragments != pixels {
+			t.Errorf("%s has %d fragments, want one for each of its %d pixels", name, fragments, pixels)
+		}
+	}
+
+	// The square is drawn after the wall, so it passes the depth test as well
+	squareFragments, _ := draw(t, square)
+	if fragments, pixels := draw(t, mergeObjects(wall, square)); fragments != pixels+squareFragments {
+		t.Errorf("square in front of the wall has %d fragments, want %d", fragments, pixels+squareFragments)
+	}
+}
+
+func TestTileOverlay_Value(t *testing.T) {
+	stats := &TileStats{
+		Triangles:  3,
+		Fragments:  200,
+		RasterTime: 150 * time.Microsecond,
+		ShadeTime:  50 * time.Microsecond,
+	}
+
+	tests := map[TileOverlay]float32{
+		TileOverlayNone:      0,
+		TileOverlayTriangles: 3,
+		TileOverlayFragments: 200,
+		TileOverlayTime:      200,
+	}
+
+	for overlay, want := range tests {
+		t.Run(overlay.String(), func(t *testing.T) {
+			if got := overlay.Value(stats); got != want {
+				t.Errorf("got %g, want %g", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+)
+
+// ToneMapping maps HDR colors with unbounded intensity to the displayable 0..1 range.
+type ToneMapping int
+
+const (
+	ToneMappingClamp ToneMapping = iota
+	ToneMappingReinhard
+	ToneMappingACES
+)
+
+func (t ToneMapping) String() string {
+	switch t {
+	case ToneMappingClamp:
+		return "clamp"
+	case ToneMappingReinhard:
+		return "reinhard"
+	case ToneMappingACES:
+		return "aces"
+	default:
+		return fmt.Sprintf("ToneMapping(%d)", int(t))
+	}
+}
+
+// Apply returns the tone mapped color. The result may still slightly exceed 1.0
+// and should be clamped when converted to 8 bits per channel.
+func (t ToneMapping) Apply(c RGB) RGB {
+	switch t {
+	case ToneMappingReinhard:
+		return RGB{reinhard(c.R), reinhard(c.G), reinhard(c.B)}
+	case ToneMappingACES:
+		return RGB{aces(c.R), aces(c.G), aces(c.B)}
+	default:
+		return c
+	}
+}
+
+func reinhard(x float32) float32 {
+	return x / (1 + x)
+}
+
+// aces is the curve fit of the ACES filmic tone mapping by Krzysztof Narkowicz.
+func aces(x float32) float32 {
+	const a, b, c, d, e = 2.51, 0.03, 2.43, 0.59, 0.14
+	return (x * (a*x + b)) / (x*(c*x+d) + e)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestToneMapping_Apply(t *testing.T) {
+	tests := map[string]struct {
+		mapping ToneMapping
+		in      float32
+		want    float32
+	}{
+		"clamp black":     {mapping: ToneMappingClamp, in: 0, want: 0},
+		"clamp unchanged": {mapping: ToneMappingClamp, in: 4, want: 4},
+		"reinhard black":  {mapping: ToneMappingReinhard, in: 0, want: 0},
+		"reinhard one":    {mapping: ToneMappingReinhard, in: 1, want: 0.5},
+		"reinhard three":  {mapping: ToneMappingReinhard, in: 3, want: 0.75},
+		"reinhard bright": {mapping: ToneMappingReinhard, in: 999, want: 0.999},
+		"aces black":      {mapping: ToneMappingACES, in: 0, want: 0},
+		"aces one":        {mapping: ToneMappingACES, in: 1, want: 2.54 / 3.16},
+		"aces bright":     {mapping: ToneMappingACES, in: 1e4, want: 2.51 / 2.43},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tt.mapping.Apply(RGB{tt.in, tt.in, tt.in})
+
+			if got.R != got.G || got.G != got.B {
+				t.Fatalf("gray has changed color: %v", got)
+			}
+
+			if abs(got.R-tt.want) > 1e-4 {
+				t.Errorf("got %g, want %g", got.R, tt.want)
+			}
+		})
+	}
+}
+
+func TestToneMapping_Monotonic(t *testing.T) {
+	for _, mapping := range []ToneMapping{ToneMappingReinhard, ToneMappingACES} {
+		t.Run(mapping.String(), func(t *testing.T) {
+			prev := float32(-1)
+
+			for x := float32(0); x < 16; x += 0.05 {
+				got := mapping.Apply(RGB{x, x, x}).R
+				if got <= prev {
+					t.Fatalf("%g maps to %g, not brighter than %g", x, got, prev)
+				}
+
+				prev = got
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"image"
+)
+
+// Viewport is a region of the frame buffer the scene is drawn into with its own camera.
+// The camera projection is mapped onto Rect, which also gives the aspect ratio. Pixels
+// outside Scissor are left untouched, which allows to draw a part of the projection only.
+// Empty Rect covers the whole frame buffer, and empty Scissor is the same as Rect.
+type Viewport struct {
+	Camera  *Camera
+	Rect    image.Rectangle
+	Scissor image.Rectangle
+}
+
+// bounds returns the projection rectangle and the region of the frame buffer
+// the viewport draws into. The region is empty if the viewport is not visible.
+func (v *Viewport) bounds(width, height int) (rect, scissor image.Rectangle) {
+	frame := image.Rect(0, 0, width, height)
+
+	rect = v.Rect
+	if rect.Empty() {
+		rect = frame
+	}
+
+	scissor = rect.Intersect(frame)
+	if !v.Scissor.Empty() {
+		scissor = scissor.Intersect(v.Scissor)
+	}
+
+	return rect, scissor
+}
+
+// SplitViewports divides the rectangle into a grid of columns × rows viewport rectangles,
+// ordered left to right and top to bottom. The last row and column take the remainder.
+func SplitViewports(rect image.Rectangle, columns, rows int) []image.Rectangle {
+	var (
+		rects  = make([]image.Rectangle, 0, columns*rows)
+		width  = rect.Dx() / columns
+		height = rect.Dy() / rows
+	)
+
+	for row := range rows {
+		for col := range columns {
+			r := image.Rect(
+				rect.Min.X+col*width,
+				rect.Min.Y+row*height,
+				rect.Min.X+(col+1)*width,
+				rect.Min.Y+(row+1)*height,
+			)
+
+			if col == columns-1 {
+				r.Max.X = rect.Max.X
+			}
+
+			if row == rows-1 {
+				r.Max.Y = rect.Max.Y
+			}
+
+			rects = append(rects, r)
+		}
+	}
+
+	return rects
+}
+
+// drawnViewport keeps the view of a viewport drawn in the last frame, so that the pixels
+// can be mapped back to the world space between the frames, see Renderer.Pick.
+type drawnViewport struct {
+	scissor image.Rectangle
+	rays    viewRays
+	eye     Vec3
+}
+
+// setScissor restricts the tile passes and the rasterization to the region of the frame.
+// Tiles outside of the region become empty and are skipped by the triangle binning.
+func (r *Renderer) setScissor(scissor image.Rectangle) {
+	r.scissor = scissor
+	r.fb.scissor = scissor
+
+	for i := range r.numTiles {
+		start, end := r.gridBounds[i][0], r.gridBounds[i][1]
+
+		start.X = max(start.X, float32(scissor.Min.X))
+		start.Y = max(start.Y, float32(scissor.Min.Y))
+		end.X = max(min(end.X, float32(scissor.Max.X)), start.X)
+		end.Y = max(min(end.Y, float32(scissor.Max.Y)), start.Y)
+
+		r.tileBounds[i] = [2]Vec2{start, end}
+	}
+}
+
+// clearTile clears the part of the viewport in the tile, for the viewports drawn over
+// the previous ones.
+func (r *Renderer) clearTile(tile uint) {
+	start, end := r.tileBounds[tile][0], r.tileBounds[tile][1]
+	r.fb.ClearRect(backgroundColor, int(start.X), int(start.Y), int(end.X), int(end.Y))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSplitViewports(t *testing.T) {
+	rects := SplitViewports(image.Rect(10, 0, 111, 51), 2, 2)
+
+	want := []image.Rectangle{
+		image.Rect(10, 0, 60, 25),
+		image.Rect(60, 0, 111, 25),
+		image.Rect(10, 25, 60, 51),
+		image.Rect(60, 25, 111, 51),
+	}
+
+	if len(rects) != len(want) {
+		t.Fatalf("got %d viewports, want %d", len(rects), len(want))
+	}
+
+	for i := range want {
+		if rects[i] != want[i] {
+			t.Errorf("viewport %d is %v, want %v", i, rects[i], want[i])
+		}
+	}
+}
+
+func TestRenderer_DrawViewports(t *testing.T) {
+	const width, height = 64, 48
+
+	object := NewObject(newRoomMesh(2, 1))
+	scene := &Scene{
+		Objects: []*Object{object},
+		Lights:  DefaultLights(),
+	}
+
+	renderer := newTestRenderer(width, height)
+	renderer.BackfaceCulling = false // the room faces point inwards
+	renderer.Picking = true
+
+	camera := NewCamera(Vec3{0, 0, 5}, Vec3{0, 0, -1})
+	viewports := []Viewport{
+		{Camera: camera, Rect: image.Rect(0, 0, width/2, height)},
+		{Camera: camera, Rect: image.Rect(width/2, 0, width, height), Scissor: image.Rect(0, 0, width, height/2)},
+	}
+
+	renderer.DrawViewports(scene, viewports)
+
+	tests := []struct {
+		x, y     int
+		viewport int
+	}{
+		{width / 4, height / 2, 0},
+		{width * 3 / 4, height / 4, 1},
+	}
+
+	for _, tt := range tests {
+		result, ok := renderer.Pick(tt.x, tt.y)
+		if !ok {
+			t.Errorf("nothing picked at %d,%d", tt.x, tt.y)
+			continue
+		}
+
+		if result.Viewport != tt.viewport {
+			t.Errorf("picked viewport %d at %d,%d, want %d", result.Viewport, tt.x, tt.y, tt.viewport)
+		}
+
+		// The closest face of the box is at Z=1
+		if p := result.Position; abs(p.Z-1) > 0.05 || abs(p.X) > 1 || abs(p.Y) > 1 {
+			t.Errorf("picked position %v at %d,%d is not on the front face", p, tt.x, tt.y)
+		}
+	}
+
+	// Pixels outside of the scissor rectangle are not drawn
+	for y := height / 2; y < height; y++ {
+		for x := width / 2; x < width; x++ {
+			index := y*width + x
+
+			if renderer.fb.ObjectIDs[index] != 0 || renderer.fb.Pixels[index] != backgroundColor {
+				t.Fatalf("pixel %d,%d outside of the scissor was drawn", x, y)
+			}
+		}
+	}
+
+	if _, ok := renderer.Pick(width*3/4, height*3/4); ok {
+		t.Errorf("picked the object outside of the scissor")
+	}
+}